@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// sessionConfig is a reusable trace setup loaded by `--config`, a YAML file,
+// or a TOML file if its extension is .toml, like:
+//
+//	binary: ./main
+//	uprobes:
+//	  - main.*
+//	  - fmt.Print*
+//	fetch:
+//	  main.(*Student).String:
+//	    - s.name=(*+0(%ax)):c64
+//	    - s.name.len=(+8(%ax)):s64
+//	conditions:
+//	  main.(*Student).String: s.name == "bob"
+//	drilldown: main.doSomething
+//	yes: true
+//	duration: 30s
+//
+// Flags and args specified in the command line override the config, if the
+// config specifies the binary, pid or command, the args are fetch specs
+// unless the first one is a file to trace instead of the binary.
+type sessionConfig struct {
+	Binary        string              `yaml:"binary" toml:"binary"`
+	Pid           int                 `yaml:"pid" toml:"pid"`
+	Command       []string            `yaml:"command" toml:"command"`
+	Goid          []int64             `yaml:"goid" toml:"goid"`
+	DebugFile     string              `yaml:"debug_file" toml:"debug_file"`
+	Uprobes       []string            `yaml:"uprobes" toml:"uprobes"`
+	ExcludeVendor *bool               `yaml:"exclude_vendor" toml:"exclude_vendor"`
+	Exclude       []string            `yaml:"exclude" toml:"exclude"`
+	Fetch         map[string][]string `yaml:"fetch" toml:"fetch"`           // funcname: [varname=expression]
+	Conditions    map[string]string   `yaml:"conditions" toml:"conditions"` // funcname: condition on the fetched args
+	Drilldown     stringList          `yaml:"drilldown" toml:"drilldown"`
+	MinDuration   time.Duration       `yaml:"min_duration" toml:"min_duration"`
+	Yes           *bool               `yaml:"yes" toml:"yes"`
+	MaxUprobes    *int                `yaml:"max_uprobes" toml:"max_uprobes"`
+	Duration      time.Duration       `yaml:"duration" toml:"duration"`
+	MaxEvents     int                 `yaml:"max_events" toml:"max_events"`
+	MaxRoots      int                 `yaml:"max_roots" toml:"max_roots"`
+	Output        stringList          `yaml:"output" toml:"output"`
+	Summary       *time.Duration      `yaml:"summary" toml:"summary"`
+	OutputFile    string              `yaml:"output_file" toml:"output_file"`
+	Color         string              `yaml:"color" toml:"color"`
+	RotateSize    string              `yaml:"rotate_size" toml:"rotate_size"` // like 100M
+	RotateCount   *int                `yaml:"rotate_count" toml:"rotate_count"`
+	Time          string              `yaml:"time" toml:"time"`
+	TUI           *bool               `yaml:"tui" toml:"tui"`
+}
+
+// maxGoids is the max number of goroutines to trace, see goid_filter in ftrace.c
+const maxGoids = 1000
+
+// loadConfig loads the session config from file `path`, YAML or TOML by its extension
+func loadConfig(path string) (cfg *sessionConfig, err error) {
+	if filepath.Ext(path) == ".toml" {
+		return loadTOMLConfig(path)
+	}
+
+	fin, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer fin.Close()
+
+	dec := yaml.NewDecoder(fin)
+	dec.KnownFields(true)
+	cfg = &sessionConfig{}
+	if err = dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "invalid config %s", path)
+	}
+	return cfg, nil
+}
+
+// loadTOMLConfig loads the session config from TOML file `path`
+func loadTOMLConfig(path string) (cfg *sessionConfig, err error) {
+	cfg = &sessionConfig{}
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config %s", path)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+		return nil, errors.Errorf("invalid config %s: unknown field %s", path, undecoded[0])
+	}
+	return cfg, nil
+}
+
+// stringList is a list of strings in config, a single string is accepted as
+// a list of one element, e.g. `output: json` and `output: [text, json=a.json]`.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = stringList{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+func (l *stringList) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*l = stringList{v}
+	case []interface{}:
+		for _, elem := range v {
+			s, ok := elem.(string)
+			if !ok {
+				return errors.Errorf("expected string, got %T", elem)
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return errors.Errorf("expected string or array of strings, got %T", value)
+	}
+	return nil
+}
+
+// hasTarget reports whether the config specifies the binary, pid or command to trace
+func (c *sessionConfig) hasTarget() bool {
+	return c.Binary != "" || c.Pid != 0 || len(c.Command) != 0
+}
+
+// isFile reports whether `path` is a regular file
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// fetchSpecs converts the fetch and conditions sections to the form of command line args,
+// like: main.(*Student).String(s.name=(*+0(%ax)):c64, s.name.len=(+8(%ax)):s64) if s.name.len == 3
+func (c *sessionConfig) fetchSpecs() (specs []string) {
+	for funcname, args := range c.Fetch {
+		if len(args) == 0 {
+			specs = append(specs, funcname)
+			continue
+		}
+		spec := fmt.Sprintf("%s(%s)", funcname, strings.Join(args, ", "))
+		if cond := c.Conditions[funcname]; cond != "" {
+			spec += " if " + cond
+		}
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+	return
+}
+
+// tracerOptions builds the TracerOptions from the config file and the command line,
+// the command line takes precedence over the config file.
+func tracerOptions(cmd *cobra.Command, args []string) (opts *TracerOptions, err error) {
+	flags := cmd.Flags()
+
+	cfg := &sessionConfig{}
+	if path, _ := flags.GetString("config"); path != "" {
+		if cfg, err = loadConfig(path); err != nil {
+			return
+		}
+	}
+
+	opts = &TracerOptions{}
+
+	// the target: -- <command>, -p <pid> or <binary>, or the one in config
+	opts.Pid, _ = flags.GetInt("pid")
+	fetch := args
+	switch dash := cmd.ArgsLenAtDash(); {
+	case dash >= 0:
+		fetch, opts.Command = args[:dash], args[dash:]
+	case opts.Pid != 0:
+	case len(args) > 0 && (!cfg.hasTarget() || isFile(args[0])):
+		opts.Bin, fetch = args[0], args[1:]
+	default:
+		opts.Bin, opts.Pid, opts.Command = cfg.Binary, cfg.Pid, cfg.Command
+	}
+	if opts.Bin == "" && opts.Pid == 0 && len(opts.Command) == 0 {
+		return nil, errors.New("binary, pid or command not specified")
+	}
+
+	goids, _ := flags.GetInt64Slice("goid")
+	if !flags.Changed("goid") {
+		goids = cfg.Goid
+	}
+	if len(goids) > maxGoids {
+		return nil, errors.Errorf("too many goroutines to trace: %d > %d", len(goids), maxGoids)
+	}
+	for _, goid := range goids {
+		if goid <= 0 {
+			return nil, errors.Errorf("invalid goroutine id %d", goid)
+		}
+		opts.Goids = append(opts.Goids, uint64(goid))
+	}
+
+	opts.DebugFile, _ = flags.GetString("debug-file")
+	if !flags.Changed("debug-file") {
+		opts.DebugFile = cfg.DebugFile
+	}
+
+	opts.Fetch = fetch
+	if len(fetch) == 0 {
+		opts.Fetch = cfg.fetchSpecs()
+	}
+
+	opts.UprobeWildcards = selectorsFlag(cmd, "uprobe-wildcards")
+	if !flags.Changed("uprobe-wildcards") {
+		opts.UprobeWildcards = cfg.Uprobes
+	}
+	if len(opts.UprobeWildcards) == 0 {
+		return nil, errors.New("uprobe wildcards not specified")
+	}
+
+	opts.Excludes = selectorsFlag(cmd, "exclude")
+	if !flags.Changed("exclude") {
+		opts.Excludes = cfg.Exclude
+	}
+	opts.ExcludeVendor, _ = flags.GetBool("exclude-vendor")
+	if cfg.ExcludeVendor != nil && !flags.Changed("exclude-vendor") {
+		opts.ExcludeVendor = *cfg.ExcludeVendor
+	}
+	opts.Drilldown = selectorsFlag(cmd, "drilldown")
+	if !flags.Changed("drilldown") {
+		opts.Drilldown = cfg.Drilldown
+	}
+	opts.MinDuration, _ = flags.GetDuration("min-duration")
+	if !flags.Changed("min-duration") {
+		opts.MinDuration = cfg.MinDuration
+	}
+	opts.AssumeYes, _ = flags.GetBool("yes")
+	if cfg.Yes != nil && !flags.Changed("yes") {
+		opts.AssumeYes = *cfg.Yes
+	}
+	opts.MaxUprobes, _ = flags.GetInt("max-uprobes")
+	if cfg.MaxUprobes != nil && !flags.Changed("max-uprobes") {
+		opts.MaxUprobes = *cfg.MaxUprobes
+	}
+	opts.Duration, _ = flags.GetDuration("duration")
+	if !flags.Changed("duration") {
+		opts.Duration = cfg.Duration
+	}
+	opts.MaxEvents, _ = flags.GetInt("max-events")
+	if !flags.Changed("max-events") {
+		opts.MaxEvents = cfg.MaxEvents
+	}
+	opts.MaxRoots, _ = flags.GetInt("max-roots")
+	if !flags.Changed("max-roots") {
+		opts.MaxRoots = cfg.MaxRoots
+	}
+	opts.Outputs, _ = flags.GetStringSlice("output")
+	explicit := flags.Changed("output")
+	if !flags.Changed("output") && len(cfg.Output) != 0 {
+		opts.Outputs, explicit = cfg.Output, true
+	}
+	if flags.Changed("summary") || flags.Changed("summary-interval") {
+		summary, _ := flags.GetBool("summary")
+		interval, _ := flags.GetDuration("summary-interval")
+		if summary || interval > 0 {
+			opts.Outputs, explicit = withSummary(opts.Outputs, explicit, interval), true
+		}
+	} else if cfg.Summary != nil {
+		opts.Outputs, explicit = withSummary(opts.Outputs, explicit, *cfg.Summary), true
+	}
+	opts.TUI, _ = flags.GetBool("tui")
+	if cfg.TUI != nil && !flags.Changed("tui") {
+		opts.TUI = *cfg.TUI
+	}
+	if opts.TUI && !explicit {
+		// the call trees are browsed in the UI instead of printed
+		opts.Outputs = nil
+	}
+	opts.OutputFile, _ = flags.GetString("output-file")
+	if !flags.Changed("output-file") && cfg.OutputFile != "" {
+		opts.OutputFile = cfg.OutputFile
+	}
+	opts.Color, _ = flags.GetString("color")
+	if !flags.Changed("color") && cfg.Color != "" {
+		opts.Color = cfg.Color
+	}
+	rotateSize, _ := flags.GetString("rotate-size")
+	if !flags.Changed("rotate-size") && cfg.RotateSize != "" {
+		rotateSize = cfg.RotateSize
+	}
+	if opts.RotateSize, err = parseSize(rotateSize); err != nil {
+		return
+	}
+	opts.RotateCount, _ = flags.GetInt("rotate-count")
+	if !flags.Changed("rotate-count") && cfg.RotateCount != nil {
+		opts.RotateCount = *cfg.RotateCount
+	}
+	opts.Time, _ = flags.GetString("time")
+	if !flags.Changed("time") && cfg.Time != "" {
+		opts.Time = cfg.Time
+	}
+	return opts, nil
+}
+
+// selectorsFlag returns the selectors of the repeatable flag `name`, each
+// value may hold several selectors separated by commas, see splitSelectors.
+func selectorsFlag(cmd *cobra.Command, name string) (selectors []string) {
+	values, _ := cmd.Flags().GetStringArray(name)
+	for _, value := range values {
+		selectors = append(selectors, splitSelectors(value)...)
+	}
+	return
+}
+
+// splitSelectors splits `value` like 'main.*,net/http.*' by commas, except
+// the commas escaped by `\` or inside [...] like main.Map[go.shape.int,go.shape.string],
+// and a re:<regexp> takes the rest of the value, like 'main.*,re:^main\.f{1,3}$'.
+func splitSelectors(value string) (selectors []string) {
+	start, depth := 0, 0
+	for i := 0; i < len(value); i++ {
+		if i == start && strings.HasPrefix(value[i:], "re:") {
+			break
+		}
+		switch value[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				if i > start {
+					selectors = append(selectors, value[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(value) {
+		selectors = append(selectors, value[start:])
+	}
+	return
+}
+
+// withSummary adds the summary output printed every `interval` (on exit if
+// it's 0) to the output specs, the default text output is replaced unless
+// the outputs are `explicit`, printing each call tree is useless for huge
+// number of calls.
+func withSummary(outputs []string, explicit bool, interval time.Duration) []string {
+	summary := "summary"
+	if interval > 0 {
+		summary += "=" + interval.String()
+	}
+	if !explicit {
+		return []string{summary}
+	}
+	return append(outputs, summary)
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// parseTraceCmd parses `args` by a new command with the flags of the root
+// command used by the tests, and returns it and the positional args.
+func parseTraceCmd(t *testing.T, args ...string) (*cobra.Command, []string) {
+	cmd := &cobra.Command{}
+	flags := cmd.Flags()
+	flags.StringP("config", "c", "", "")
+	flags.IntP("pid", "p", 0, "")
+	flags.StringArrayP("uprobe-wildcards", "u", nil, "")
+	flags.StringArrayP("exclude", "e", nil, "")
+	flags.StringArrayP("drilldown", "D", nil, "")
+	flags.BoolP("yes", "y", false, "")
+	flags.Int("max-uprobes", 0, "")
+	flags.Duration("duration", 0, "")
+	flags.StringSlice("output", []string{"text"}, "")
+	flags.Bool("summary", false, "")
+	flags.Duration("summary-interval", 0, "")
+	require.Nil(t, cmd.ParseFlags(args))
+	return cmd, flags.Args()
+}
+
+// writeConfig writes the config `content` into file `name` of a temporary directory
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func Test_LoadConfig(t *testing.T) {
+	yamlConfig := writeConfig(t, "trace.yaml", `
+binary: ./main
+uprobes: ['main.*', 'fmt.Print*']
+fetch:
+  main.add: [a=(%ax):s64, b=(%bx):s64]
+conditions:
+  main.add: a == 1
+drilldown: main.doSomething
+yes: true
+max_uprobes: 1000
+duration: 30s
+output: [text, json=a.json]
+`)
+	tomlConfig := writeConfig(t, "trace.toml", `
+binary = "./main"
+uprobes = ["main.*", "fmt.Print*"]
+drilldown = "main.doSomething"
+yes = true
+max_uprobes = 1000
+duration = "30s"
+output = ["text", "json=a.json"]
+
+[fetch]
+"main.add" = ["a=(%ax):s64", "b=(%bx):s64"]
+
+[conditions]
+"main.add" = "a == 1"
+`)
+	yamlCfg, err := loadConfig(yamlConfig)
+	require.Nil(t, err)
+	tomlCfg, err := loadConfig(tomlConfig)
+	require.Nil(t, err)
+	require.Equal(t, yamlCfg, tomlCfg)
+	require.Equal(t, []string{"main.add(a=(%ax):s64, b=(%bx):s64) if a == 1"}, tomlCfg.fetchSpecs())
+	require.Equal(t, 30*time.Second, tomlCfg.Duration)
+
+	_, err = loadConfig(writeConfig(t, "unknown.yaml", "binaries: ./main\n"))
+	require.NotNil(t, err)
+	_, err = loadConfig(writeConfig(t, "unknown.toml", "binaries = \"./main\"\n"))
+	require.NotNil(t, err)
+}
+
+func Test_TracerOptionsConfig(t *testing.T) {
+	config := writeConfig(t, "trace.yaml", `
+binary: ./main
+uprobes: ['main.*']
+fetch:
+  main.add: [a=(%ax):s64]
+yes: true
+max_uprobes: 1000
+duration: 30s
+output: json
+`)
+
+	// from the config
+	cmd, args := parseTraceCmd(t, "-c", config)
+	opts, err := tracerOptions(cmd, args)
+	require.Nil(t, err)
+	require.Equal(t, "./main", opts.Bin)
+	require.Equal(t, []string{"main.*"}, opts.UprobeWildcards)
+	require.Equal(t, []string{"main.add(a=(%ax):s64)"}, opts.Fetch)
+	require.True(t, opts.AssumeYes)
+	require.Equal(t, 1000, opts.MaxUprobes)
+	require.Equal(t, 30*time.Second, opts.Duration)
+	require.Equal(t, []string{"json"}, opts.Outputs)
+
+	// flags override the config, args are fetch specs as the config specifies the binary
+	cmd, args = parseTraceCmd(t, "-c", config, "-u", "net/*", "--yes=false", "--max-uprobes", "10",
+		"--duration", "1s", "--output", "text", "main.minus(b=(%bx):s64)")
+	opts, err = tracerOptions(cmd, args)
+	require.Nil(t, err)
+	require.Equal(t, "./main", opts.Bin)
+	require.Equal(t, []string{"net/*"}, opts.UprobeWildcards)
+	require.Equal(t, []string{"main.minus(b=(%bx):s64)"}, opts.Fetch)
+	require.False(t, opts.AssumeYes)
+	require.Equal(t, 10, opts.MaxUprobes)
+	require.Equal(t, time.Second, opts.Duration)
+	require.Equal(t, []string{"text"}, opts.Outputs)
+
+	// an existing file overrides the binary of config
+	cmd, args = parseTraceCmd(t, "-c", config, config, "main.minus(b=(%bx):s64)")
+	opts, err = tracerOptions(cmd, args)
+	require.Nil(t, err)
+	require.Equal(t, config, opts.Bin)
+	require.Equal(t, []string{"main.minus(b=(%bx):s64)"}, opts.Fetch)
+}
+
+func Test_TracerOptionsConfigTarget(t *testing.T) {
+	command := writeConfig(t, "command.yaml", "command: [./main, --flag]\nuprobes: ['main.*']\n")
+	pid := writeConfig(t, "pid.yaml", "pid: 123\nuprobes: ['main.*']\n")
+
+	for _, tt := range []struct {
+		args    []string
+		bin     string
+		pid     int
+		command []string
+		fetch   []string
+	}{
+		{args: []string{"-c", command}, command: []string{"./main", "--flag"}},
+		{args: []string{"-c", command, "main.add"}, command: []string{"./main", "--flag"}, fetch: []string{"main.add"}},
+		{args: []string{"-c", command, "main.add", "--", "./other"}, command: []string{"./other"}, fetch: []string{"main.add"}},
+		{args: []string{"-c", command, "-p", "456"}, pid: 456},
+		{args: []string{"-c", pid}, pid: 123},
+		{args: []string{"-c", pid, "main.add"}, pid: 123, fetch: []string{"main.add"}},
+		{args: []string{"-c", pid, "-p", "456", "main.add"}, pid: 456, fetch: []string{"main.add"}},
+		{args: []string{"-c", pid, pid}, bin: pid},
+	} {
+		cmd, args := parseTraceCmd(t, tt.args...)
+		opts, err := tracerOptions(cmd, args)
+		require.Nil(t, err, tt.args)
+		require.Equal(t, tt.bin, opts.Bin, tt.args)
+		require.Equal(t, tt.pid, opts.Pid, tt.args)
+		require.Equal(t, tt.command, opts.Command, tt.args)
+		require.Equal(t, tt.fetch, opts.Fetch, tt.args)
+	}
+}
+
+func Test_TracerOptionsSummary(t *testing.T) {
+	for _, tt := range []struct {
+		args    []string
+		outputs []string
+	}{
+		{[]string{"./main"}, []string{"text"}},
+		{[]string{"--summary", "./main"}, []string{"summary"}},
+		{[]string{"--summary-interval", "10s", "./main"}, []string{"summary=10s"}},
+		{[]string{"--summary", "--summary-interval", "10s", "--output", "json", "./main"}, []string{"json", "summary=10s"}},
+	} {
+		cmd, args := parseTraceCmd(t, append([]string{"-u", "main.*"}, tt.args...)...)
+		opts, err := tracerOptions(cmd, args)
+		require.Nil(t, err, tt.args)
+		require.Equal(t, "./main", opts.Bin, tt.args)
+		require.Equal(t, tt.outputs, opts.Outputs, tt.args)
+	}
+}
+
+func Test_TracerOptionsSelectors(t *testing.T) {
+	// regexps may contain commas, they're never split
+	for _, cmd := range []*cobra.Command{rootCmd, recordCmd, listCmd} {
+		require.Nil(t, cmd.ParseFlags([]string{"-u", `re:^main\.f{1,3}$`, "-u", "main.*", "-e", `re:^main\.g{1,2}$`}))
+		opts, err := tracerOptions(cmd, []string{"./main"})
+		require.Nil(t, err, cmd.Name())
+		require.Equal(t, []string{`re:^main\.f{1,3}$`, "main.*"}, opts.UprobeWildcards, cmd.Name())
+		require.Equal(t, []string{`re:^main\.g{1,2}$`}, opts.Excludes, cmd.Name())
+	}
+
+	// the documented comma form of globs keeps working
+	cmd, args := parseTraceCmd(t, "-u", "main.*,net/http.*", "-e", "*.String,runtime.*", "-D", "main.handle*,main.doSomething", "./main")
+	opts, err := tracerOptions(cmd, args)
+	require.Nil(t, err)
+	require.Equal(t, []string{"main.*", "net/http.*"}, opts.UprobeWildcards)
+	require.Equal(t, []string{"*.String", "runtime.*"}, opts.Excludes)
+	require.Equal(t, []string{"main.handle*", "main.doSomething"}, opts.Drilldown)
+}
+
+func Test_SplitSelectors(t *testing.T) {
+	for value, selectors := range map[string][]string{
+		"main.*":              {"main.*"},
+		"main.*,net/http.*":   {"main.*", "net/http.*"},
+		"main.*,,net/http.*,": {"main.*", "net/http.*"},
+		`main.Map[go.shape.int,go.shape.string],main.F\,G`: {"main.Map[go.shape.int,go.shape.string]", `main.F\,G`},
+		`re:^main\.f{1,3}$`:                 {`re:^main\.f{1,3}$`},
+		`main.*,re:^main\.f{1,3}$`:          {"main.*", `re:^main\.f{1,3}$`},
+		"pkg:gopkg.in/yaml.v3,file:main.go": {"pkg:gopkg.in/yaml.v3", "file:main.go"},
+	} {
+		require.Equal(t, selectors, splitSelectors(value), value)
+	}
+}
+
+func Test_RootCmdArgs(t *testing.T) {
+	// the binary and fetch specs are args of the root command, not subcommands
+	bin := filepath.Join(t.TempDir(), "main")
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	rootCmd.SetArgs([]string{"-u", "main.*", bin, "main.add(a=(%ax):s64)"})
+	err := rootCmd.Execute()
+	require.NotNil(t, err)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_RecordCmdLimits(t *testing.T) {
+	// recording is bounded like tracing
+	for _, name := range []string{"duration", "max-events", "max-roots", "min-duration"} {
+		flag := recordCmd.Flags().Lookup(name)
+		require.NotNil(t, flag, name)
+		require.Equal(t, rootCmd.Flags().Lookup(name).Value.Type(), flag.Value.Type())
+	}
+}
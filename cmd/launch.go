@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// launcher starts the traced program as a child process.
+//
+// The child is started under ptrace, so it stops right after execve(2),
+// before any Go code (including `init` functions) gets executed. Then we
+// can attach all uprobes and resume the child, so nothing is missed.
+type launcher struct {
+	cmd *exec.Cmd
+}
+
+// lookupCommand returns the path to the executable of `command`.
+func lookupCommand(command []string) (bin string, err error) {
+	if len(command) == 0 {
+		return "", errors.New("empty command")
+	}
+	bin, err = exec.LookPath(command[0])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return bin, nil
+}
+
+// start starts the child process `bin` with arguments `command[1:]`, and
+// returns when the child stops after execve(2).
+//
+// ptrace requests must be issued from the thread which started the child,
+// so the caller must lock the OS thread until `resume` is called.
+func (l *launcher) start(bin string, command []string) (pid int, err error) {
+	l.cmd = exec.Command(bin, command[1:]...)
+	l.cmd.Args[0] = command[0]
+	l.cmd.Stdin = os.Stdin
+	l.cmd.Stdout = os.Stdout
+	l.cmd.Stderr = os.Stderr
+	l.cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if err = l.cmd.Start(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	pid = l.cmd.Process.Pid
+
+	// wait for the SIGTRAP stop caused by execve(2)
+	var ws syscall.WaitStatus
+	if _, err = syscall.Wait4(pid, &ws, 0, nil); err != nil {
+		l.kill()
+		return 0, errors.Wrapf(err, "wait for process %d", pid)
+	}
+	if !ws.Stopped() {
+		return 0, errors.Errorf("process %d exited unexpectedly: %v", pid, ws)
+	}
+	log.Infof("started process %d: %s", pid, bin)
+	return pid, nil
+}
+
+// resume detaches from the stopped child and lets it run.
+func (l *launcher) resume() error {
+	if err := syscall.PtraceDetach(l.cmd.Process.Pid); err != nil {
+		return errors.Wrapf(err, "resume process %d", l.cmd.Process.Pid)
+	}
+	return nil
+}
+
+// wait waits for the child to exit.
+func (l *launcher) wait() {
+	if err := l.cmd.Wait(); err != nil {
+		log.Infof("process %d exited: %v", l.cmd.Process.Pid, err)
+		return
+	}
+	log.Infof("process %d exited", l.cmd.Process.Pid)
+}
+
+// kill kills the child, used when tracing can't be set up.
+func (l *launcher) kill() {
+	l.cmd.Process.Kill()
+	l.cmd.Wait()
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var listUsageLong = `list the functions matching the wildcards, without attaching any uprobes.
+
+here're some examples:
+
+  example: list functions like main.add* and where they are:
+    ftrace list -u 'main.add*' ./main
+
+  example: list functions like github.com/ourorg/*, except the String methods:
+    ftrace list -u 'github.com/ourorg/*' -e '*.String' ./main
+
+  example: list functions like main.*, and output as JSON:
+    ftrace list -u 'main.*' --format json ./main
+ `
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list [-u wildcards|-x] <binary|-p pid> [fetch]",
+	Short: "list the functions matching the wildcards without attaching",
+	Long:  listUsageLong,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "json" {
+			return fmt.Errorf("unknown format: %s", format)
+		}
+
+		opts, err := tracerOptions(cmd, args)
+		if err != nil {
+			return err
+		}
+		tracer, err := NewTracer(opts)
+		if err != nil {
+			return err
+		}
+		funcs, err := tracer.List()
+		if err != nil {
+			return err
+		}
+
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(funcs)
+		}
+		return printFuncList(funcs)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringArrayP("uprobe-wildcards", "u", nil, "functions to add uprobes, repeated or comma separated: wildcards like main.*, pkg:<import path>, file:<source file>, or re:<regexp> taking the rest of the value")
+	listCmd.Flags().BoolP("exclude-vendor", "x", true, "exclude vendor")
+	listCmd.Flags().StringArrayP("exclude", "e", nil, "functions to exclude from the uprobe wildcards, in the same forms as -u")
+	listCmd.Flags().IntP("pid", "p", 0, "list the functions of the process with this pid")
+	listCmd.Flags().StringP("format", "f", "table", "output format: table, json")
+}
+
+// funcInfo is the information of a function matching the wildcards
+type funcInfo struct {
+	Funcname   string   `json:"funcname"`
+	Wildcard   string   `json:"wildcard"`
+	Address    uint64   `json:"address"`
+	EntOffset  uint64   `json:"entry_offset"`
+	RetOffsets []uint64 `json:"ret_offsets"`
+	Wanted     bool     `json:"wanted"`
+	Source     string   `json:"source"`
+	SkipReason string   `json:"skip_reason,omitempty"`
+	ExcludedBy string   `json:"excluded_by,omitempty"`
+}
+
+// List returns the functions that would be traced or skipped, and where they are defined
+func (t *Tracer) List() (funcs []funcInfo, err error) {
+	selections, err := t.Select()
+	if err != nil {
+		return
+	}
+	funcs = []funcInfo{}
+	for _, s := range selections {
+		source := "?:?"
+		if filename, line, err := t.elf.FuncLineInfo(s.Funcname); err == nil {
+			source = fmt.Sprintf("%s:%d", filename, line)
+		}
+		funcs = append(funcs, funcInfo{
+			Funcname:   s.Funcname,
+			Wildcard:   s.Wildcard,
+			Address:    s.Address,
+			EntOffset:  s.EntOffset,
+			RetOffsets: s.RetOffsets,
+			Wanted:     s.Wanted,
+			Source:     source,
+			SkipReason: s.SkipReason,
+			ExcludedBy: s.ExcludedBy,
+		})
+	}
+	return
+}
+
+// printFuncList prints the functions as a table
+func printFuncList(funcs []funcInfo) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FUNCTION\tENTRY\tRET\tWANTED\tSOURCE\tSKIPPED")
+
+	var skipped int
+	for _, f := range funcs {
+		rets := make([]string, 0, len(f.RetOffsets))
+		for _, off := range f.RetOffsets {
+			rets = append(rets, fmt.Sprintf("0x%x", off))
+		}
+		wanted := ""
+		if f.Wanted && f.SkipReason == "" {
+			wanted = "*"
+		}
+		if f.SkipReason != "" {
+			skipped++
+		}
+		reason := f.SkipReason
+		if f.ExcludedBy != "" {
+			reason += " by " + f.ExcludedBy
+		}
+		fmt.Fprintf(w, "%s\t0x%x\t%s\t%s\t%s\t%s\n",
+			f.Funcname, f.EntOffset, strings.Join(rets, ","), wanted, f.Source, reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d functions matched, %d skipped\n", len(funcs), skipped)
+	return nil
+}
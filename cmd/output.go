@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
+	"github.com/pkg/errors"
+)
+
+// outputOptions specifies where and how the outputs are written
+type outputOptions struct {
+	File        string // write to the file instead of stdout
+	Color       string // auto, always, never
+	RotateSize  int64  // rotate the file if it exceeds the size, 0 means never rotate
+	RotateCount int    // number of rotated files kept
+	Time        string // timestamp mode of the text output, see eventmanager.OutputOptions
+}
+
+// createOutput creates the outputs specified by `specs`, see eventmanager.NewOutputs
+func createOutput(specs []string, opts outputOptions) (_ eventmanager.Output, err error) {
+	var w io.Writer = os.Stdout
+	if opts.File != "" {
+		if w, err = eventmanager.CreateRotateFile(opts.File, opts.RotateSize, opts.RotateCount); err != nil {
+			return
+		}
+	}
+
+	output, err := eventmanager.NewOutputs(specs, w, eventmanager.OutputOptions{Time: opts.Time, Color: opts.Color})
+	if err != nil {
+		if f, ok := w.(*eventmanager.RotateFile); ok {
+			f.Close()
+		}
+		return
+	}
+	return output, nil
+}
+
+// parseSize parses the size like 512K, 100M, 1G, or bytes without unit
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	size, unit := s, int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size %s, want like 512K, 100M, 1G", size)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var recordUsageLong = `record the events of tracing into a trace file, to replay it offline later by 'ftrace replay'.
+
+the trace file contains the raw events, the uprobes, the build ID of the binary and the
+symbols of the addresses in the events, so it can be replayed without the binary or root.
+
+here're some examples:
+
+  example: record the events of main.* for 30s into trace.ftr:
+    ftrace record -u 'main.*' --duration 30s -o trace.ftr ./main
+
+  example: record until 100 root calls took at least 5ms, replay outputs only them by default:
+    ftrace record -u 'main.*' --max-roots 100 --min-duration 5ms -o trace.ftr ./main
+
+  example: record a running process, and fetch the arguments:
+    ftrace record -u 'main.(*Student).String' -o trace.ftr -p 12345 \
+      'main.(*Student).String(s.name=(*+0(%ax)):c64, s.name.len=(+8(%ax)):s64, s.age=(+16(%ax)):s64)'
+ `
+
+// recordCmd represents the record command
+var recordCmd = &cobra.Command{
+	Use:   "record [-c config] [-u wildcards|-x|-d] -o <file> <binary|-p pid> [fetch] | [-u wildcards|-x|-d] -o <file> [fetch] -- <command> [args]",
+	Short: "record the events of tracing into a trace file",
+	Long:  recordUsageLong,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if file, _ := cmd.Flags().GetString("output"); file == "" {
+			return errors.New("trace file not specified by -o")
+		}
+		return checkTraceArgs(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := tracerOptions(cmd, args)
+		if err != nil {
+			fmt.Println(usage)
+			return err
+		}
+		opts.Record, _ = cmd.Flags().GetString("output")
+
+		tracer, err := NewTracer(opts)
+		if err != nil {
+			return err
+		}
+
+		if err := initLimit(); err != nil {
+			return err
+		}
+
+		return tracer.Start()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+
+	recordCmd.Flags().BoolP("debug", "d", false, "enable debug logging")
+
+	recordCmd.Flags().StringArrayP("uprobe-wildcards", "u", nil, "functions to add uprobes, repeated or comma separated: wildcards like main.*, pkg:<import path>, file:<source file>, or re:<regexp> taking the rest of the value")
+	recordCmd.Flags().BoolP("exclude-vendor", "x", true, "exclude vendor")
+	recordCmd.Flags().StringArrayP("exclude", "e", nil, "functions to exclude from the uprobe wildcards, in the same forms as -u, functions to fetch are never excluded")
+	recordCmd.Flags().BoolP("yes", "y", false, "attach uprobes without confirmation")
+	recordCmd.Flags().Int("max-uprobes", 0, "refuse to attach if more uprobes are found, 0 means no limit")
+	recordCmd.Flags().Duration("duration", 0, "stop tracing after the duration, like 30s, 0 means no limit")
+	recordCmd.Flags().Int("max-events", 0, "stop tracing after receiving so many events, 0 means no limit")
+	recordCmd.Flags().Int("max-roots", 0, "stop tracing after recording so many completed root calls, 0 means no limit")
+	recordCmd.Flags().Duration("min-duration", 0, "only count the root calls which took at least the duration for --max-roots, like 5ms, replay only outputs them by default")
+	recordCmd.Flags().StringP("output", "o", "", "trace file to record the events")
+	recordCmd.Flags().IntP("pid", "p", 0, "only trace the process with this pid, binary is resolved from /proc/<pid>/exe")
+	recordCmd.Flags().Int64Slice("goid", nil, "only trace the goroutines with these ids, like 1234,5678")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
+	"github.com/hitzhangjie/go-ftrace/internal/record"
+	"github.com/hitzhangjie/go-ftrace/internal/tui"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var replayUsageLong = `replay the trace file recorded by 'ftrace record', and output the callstacks like tracing.
+
+neither the binary nor root is required, any output format works.
+
+here're some examples:
+
+  example: replay the trace file, and print the callstacks:
+    ftrace replay trace.ftr
+
+  example: replay the callstacks of main.doSomething only, and output as JSON:
+    ftrace replay -D main.doSomething --output json trace.ftr
+
+  example: browse the recorded call trees in the terminal UI:
+    ftrace replay --tui trace.ftr
+ `
+
+// errReplayStopped stops replaying when the limits reached
+var errReplayStopped = errors.New("replay stopped")
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay [-D wildcards] [--output format] <file>",
+	Short: "replay the trace file recorded by 'ftrace record'",
+	Long:  replayUsageLong,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if debug, _ := cmd.Flags().GetBool("debug"); debug {
+			log.SetLevel(log.DebugLevel)
+		}
+		drilldown := selectorsFlag(cmd, "drilldown")
+		minDuration, _ := cmd.Flags().GetDuration("min-duration")
+		outputs, _ := cmd.Flags().GetStringSlice("output")
+		explicit := cmd.Flags().Changed("output")
+		if summary, _ := cmd.Flags().GetBool("summary"); summary {
+			outputs, explicit = withSummary(outputs, explicit, 0), true
+		}
+		useTUI, _ := cmd.Flags().GetBool("tui")
+		if useTUI && !explicit {
+			outputs = nil
+		}
+		maxRoots, _ := cmd.Flags().GetInt("max-roots")
+
+		reader, err := record.Open(args[0])
+		if err != nil {
+			return
+		}
+		header := reader.Header
+		if !cmd.Flags().Changed("min-duration") {
+			minDuration = header.MinDuration
+		}
+		buildID := header.GNUBuildID
+		if buildID == "" {
+			buildID = header.GoBuildID
+		}
+		log.Infof("replay %s, recorded at %s, binary %s, build id %s",
+			args[0], header.StartTime.Format("2006-01-02 15:04:05"), header.Binary, buildID)
+
+		opts := outputOptions{}
+		opts.File, _ = cmd.Flags().GetString("output-file")
+		opts.Color, _ = cmd.Flags().GetString("color")
+		opts.Time, _ = cmd.Flags().GetString("time")
+		output, err := createOutput(outputs, opts)
+		if err != nil {
+			return
+		}
+		if useTUI {
+			ui := tui.New()
+			output = eventmanager.MultiOutput(ui, output)
+			ui.Start()
+		}
+		defer func() {
+			if cerr := output.Close(); err == nil {
+				err = cerr
+			}
+		}()
+
+		eventManager, err := eventmanager.New(header.Uprobes, reader.Snapshot, reader.Args(), eventmanager.Options{
+			Drilldown:   drilldown,
+			MinDuration: minDuration,
+			LoadBias:    header.LoadBias,
+			Output:      output,
+			BootTime:    header.BootTime,
+		})
+		if err != nil {
+			return
+		}
+		err = reader.Events(func(event bpf.GoftraceEvent) error {
+			if err := eventManager.Handle(event); err != nil {
+				return err
+			}
+			if maxRoots > 0 && eventManager.Roots() >= maxRoots {
+				return errReplayStopped
+			}
+			return nil
+		})
+		if err == errReplayStopped {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		return eventManager.PrintRemaining()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().BoolP("debug", "d", false, "enable debug logging")
+	replayCmd.Flags().StringArrayP("drilldown", "D", nil, "wildcards of functions to drill down, only their callstacks are output")
+	replayCmd.Flags().Duration("min-duration", 0, "only output the callstacks whose root call (or drilldown call) took at least the duration, like 5ms, --min-duration of recording by default")
+	replayCmd.Flags().Int("max-roots", 0, "stop replaying after printing so many completed root calls, 0 means no limit")
+	replayCmd.Flags().StringP("output-file", "o", "", "write the outputs to the file instead of stdout")
+	replayCmd.Flags().String("color", "auto", "color the text output: auto, always, never")
+	replayCmd.Flags().String("time", "wall", "timestamps of the text output: "+strings.Join(eventmanager.TimeModes, ", "))
+	replayCmd.Flags().Bool("summary", false, "print the statistics and latency histogram of each function on exit")
+	replayCmd.Flags().Bool("tui", false, "browse the root calls and their call trees in an interactive terminal UI")
+	replayCmd.Flags().StringSlice("output", []string{"text"}, "output format, or format=file, can be repeated: "+strings.Join(eventmanager.Formats, ", "))
+}
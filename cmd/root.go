@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 
+	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/sys/unix"
@@ -19,8 +21,9 @@ var usage = `go-ftrace is bpf(2)-based ftrace(1)-like function graph tracer for
 for now, only support following cases:
 - OS: Linux, with support for bpf(2) and uprobe
 - Arch: x86-64 little endian
-- Binary: go ELF executable, non-stripped, built with non-PIE mode,
-          ELF sections .symtab, .(z)debug_info are required
+- Binary: go ELF executable, .symtab and .(z)debug_info are preferred,
+          stripped executable falls back to .gopclntab,
+          PIE executable can only be traced with -p <pid> or -- <command>
 `
 
 var usageLong = `go-ftrace is an eBPF(2)-based ftrace(1)-like function graph tracer for Go!
@@ -35,6 +38,7 @@ here're some tracing examples:
 
   example: trace all functions like main.add* or main.minus*:
     ftrace -u 'main.add*' -u 'main.minus*' ./main
+    ftrace -u 'main.add*,main.minus*' ./main
 
   example: trace a specific function and include runtime.chan* builtins:
     ftrace -u 'main.add' -u 'runtime.chan*' ./main
@@ -42,35 +46,101 @@ here're some tracing examples:
   example: trace a specific method of specific type:
     ftrace -u 'main.(*Student).String ./main    
 
+  example: trace the functions of our packages, except the runtime and the String methods:
+    ftrace -u 'github.com/ourorg/*' -e 'runtime.*' -e '*.String' ./main
+
+  example: select functions by a regexp, by an import path (including methods, closures and generic instantiations), or by a source file:
+    ftrace -u 're:^main\.handle(Get|Put)$' -u 'pkg:github.com/ourorg/svc' -u 'file:handler.go' ./main
+
+  example: trace functions of a running process only, other processes of the same binary are ignored:
+    ftrace -u 'main.add*' -p 12345
+
+  example: follow a stuck or slow goroutine only, the others are filtered in kernel:
+    ftrace -u 'main.*' -p 12345 --goid 1234,5678
+
+  example: start a program and trace it, including its init functions:
+    ftrace -u 'main.*' -- ./main --flag
+
+  example: trace without confirmation, but refuse to attach more than 1000 uprobes:
+    ftrace -u 'main.*' -y --max-uprobes 1000 ./main
+
+  example: stop tracing after 30s, or after 100 completed root calls printed:
+    ftrace -u 'main.*' --duration 30s --max-roots 100 ./main
+
+  example: output JSON Lines, one object per entry/return event, or per root call tree:
+    ftrace -u 'main.*' --output json ./main | jq .
+    ftrace -u 'main.*' --output json-tree ./main | jq .
+
+  example: also export the call trees to open in Perfetto (ui.perfetto.dev) or chrome://tracing:
+    ftrace -u 'main.*' --output text --output chrome-trace=trace.json ./main
+
+  example: render where time goes inside main.doSomething as a flame graph, weighted by self time:
+    ftrace -u 'main.*' -D main.doSomething --output folded=main.folded ./main
+    flamegraph.pl --countname ns main.folded > main.svg
+
+  example: build a pprof profile of the exact calls and wall time, flat is self time and cum is total time:
+    ftrace -u 'main.*' --output pprof=main.pb.gz ./main
+    go tool pprof -top main.pb.gz
+
+  example: export each call as an OpenTelemetry span to a collector, via OTLP/HTTP or OTLP/gRPC:
+    ftrace -u 'main.*' --output otlp=http://localhost:4318 ./main
+    ftrace -u 'main.*' --output otlp=grpc://localhost:4317 ./main
+
+  example: preview the functions matched without attaching, see 'ftrace list -h':
+    ftrace list -u 'main.*' ./main
+
+  example: only print the calls of main.handle* and their callees, wherever they're called:
+    ftrace -u 'main.*' -D 'main.handle*' -D main.doSomething ./main
+
+  example: only print the call trees of main.doSomething taking 5ms or longer:
+    ftrace -u 'main.*' -D main.doSomething --min-duration 5ms ./main
+
+  example: print the calls, total/self time, percentiles and latency histogram of each function every 10s:
+    ftrace -u 'main.*' --summary-interval 10s ./main
+
+  example: print the seconds since the previous event instead of the wall time:
+    ftrace -u 'main.*' --time delta ./main
+
+  example: browse the root calls in a terminal UI, sort them by duration, search and expand the call trees:
+    ftrace -u 'main.*' --tui ./main
+
+  example: write the call trees into a file without colors, rotated every 100M:
+    ftrace -u 'main.*' -o trace.log --rotate-size 100M ./main
+
+  example: record the events into a trace file, and replay it offline, see 'ftrace record -h':
+    ftrace record -u 'main.*' -o trace.ftr ./main
+    ftrace replay trace.ftr
+
+  example: trace a stripped executable, with symbols and DWARF from the unstripped build artifact:
+    ftrace -u 'main.*' --debug-file ./main.debug ./main
+
+  example: trace with the setup in a session config file, and override its binary:
+    ftrace -c trace.yaml ./main
+
   example: trace a specific method of specific type, and fetch its arguemnts:
     ftrace -u 'main.(*Student).String' ./main \
       'main.(*Student).String(s.name=(*+0(%ax)):c64, s.name.len=(+8(%ax)):s64, s.age=(+16(%ax)):s64)'
+
+  example: only start a trace when the fetched arguments match the condition, it's evaluated in kernel:
+    ftrace -u 'main.*' ./main \
+      'main.(*Student).String(s.name=(*+0(%ax)):c64, s.name.len=(+8(%ax)):s64) if s.name == "bob"'
  `
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "ftrace [-u wildcards|-x|-d] <binary> [fetch]",
-	Short: usage,
-	Long:  usageLong,
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if debug, _ := cmd.Flags().GetBool("debug"); debug {
-			log.SetLevel(log.DebugLevel)
-		}
-
-		if len(args) < 1 {
+	Use:     "ftrace [-c config] [-u wildcards|-x|-d] <binary|-p pid> [fetch] | [-u wildcards|-x|-d] [fetch] -- <command> [args]",
+	Short:   usage,
+	Long:    usageLong,
+	Args:    cobra.ArbitraryArgs,
+	PreRunE: checkTraceArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := tracerOptions(cmd, args)
+		if err != nil {
 			fmt.Println(usage)
-			return errors.New("too few args")
+			return err
 		}
-		return nil
-	},
-	RunE: func(cmd *cobra.Command, args []string) error {
-		bin := args[0]
-		fetch := args[1:]
-		excludeVendor, _ := cmd.Flags().GetBool("exclude-vendor")
-		uprobeWildcards, _ := cmd.Flags().GetStringSlice("uprobe-wildcards")
-		drilldown, _ := cmd.Flags().GetString("drilldown")
 
-		tracer, err := NewTracer(bin, excludeVendor, uprobeWildcards, fetch, drilldown)
+		tracer, err := NewTracer(opts)
 		if err != nil {
 			return err
 		}
@@ -83,6 +153,22 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// checkTraceArgs checks the target of tracing specified in the command line
+func checkTraceArgs(cmd *cobra.Command, args []string) error {
+	if debug, _ := cmd.Flags().GetBool("debug"); debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if pid, _ := cmd.Flags().GetInt("pid"); pid != 0 && cmd.ArgsLenAtDash() >= 0 {
+		return errors.New("-p and -- <command> are mutually exclusive")
+	}
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 && dash == len(args) {
+		fmt.Println(usage)
+		return errors.New("command not specified after --")
+	}
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -97,7 +183,8 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ftrace.yaml)")
+	rootCmd.PersistentFlags().StringP("config", "c", "", "session config file, YAML or TOML (*.toml), flags and args override it")
+	rootCmd.PersistentFlags().String("debug-file", "", "separate file providing .symtab and DWARF, looked up in /usr/lib/debug/.build-id by default")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -105,11 +192,27 @@ func init() {
 
 	rootCmd.Flags().BoolP("debug", "d", false, "enable debug logging")
 
-	rootCmd.Flags().StringSliceP("uprobe-wildcards", "u", nil, "wildcards for code to add uprobes")
+	rootCmd.Flags().StringArrayP("uprobe-wildcards", "u", nil, "functions to add uprobes, repeated or comma separated: wildcards like main.*, pkg:<import path>, file:<source file>, or re:<regexp> taking the rest of the value")
 	rootCmd.Flags().BoolP("exclude-vendor", "x", true, "exclude vendor")
-	rootCmd.Flags().StringP("drilldown", "D", "", "drill down analysis")
-
-	rootCmd.MarkFlagRequired("uprobe-wildcards")
+	rootCmd.Flags().StringArrayP("exclude", "e", nil, "functions to exclude from the uprobe wildcards, in the same forms as -u, functions to fetch are never excluded")
+	rootCmd.Flags().StringArrayP("drilldown", "D", nil, "wildcards of functions to drill down, only their callstacks are output")
+	rootCmd.Flags().Duration("min-duration", 0, "only output the callstacks whose root call (or drilldown call) took at least the duration, like 5ms")
+	rootCmd.Flags().BoolP("yes", "y", false, "attach uprobes without confirmation")
+	rootCmd.Flags().Int("max-uprobes", 0, "refuse to attach if more uprobes are found, 0 means no limit")
+	rootCmd.Flags().Duration("duration", 0, "stop tracing after the duration, like 30s, 0 means no limit")
+	rootCmd.Flags().Int("max-events", 0, "stop tracing after receiving so many events, 0 means no limit")
+	rootCmd.Flags().Int("max-roots", 0, "stop tracing after printing so many completed root calls, 0 means no limit")
+	rootCmd.Flags().StringSlice("output", []string{"text"}, "output format, or format=file, can be repeated: "+strings.Join(eventmanager.Formats, ", "))
+	rootCmd.Flags().StringP("output-file", "o", "", "write the outputs to the file instead of stdout")
+	rootCmd.Flags().String("color", "auto", "color the text output: auto, always, never")
+	rootCmd.Flags().String("rotate-size", "", "rotate the output file if it exceeds the size, like 100M, chrome-trace and pprof need their own files")
+	rootCmd.Flags().Int("rotate-count", 5, "number of rotated output files kept, like file.1 ... file.5")
+	rootCmd.Flags().String("time", "wall", "timestamps of the text output: "+strings.Join(eventmanager.TimeModes, ", "))
+	rootCmd.Flags().Bool("summary", false, "print the statistics and latency histogram of each function on exit")
+	rootCmd.Flags().Duration("summary-interval", 0, "print the summary every interval like 10s, implies --summary")
+	rootCmd.Flags().Bool("tui", false, "browse the root calls and their call trees in an interactive terminal UI")
+	rootCmd.Flags().IntP("pid", "p", 0, "only trace the process with this pid, binary is resolved from /proc/<pid>/exe")
+	rootCmd.Flags().Int64Slice("goid", nil, "only trace the goroutines with these ids, like 1234,5678")
 }
 
 func initLimit() error {
@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/hitzhangjie/go-ftrace/elf"
 	"github.com/hitzhangjie/go-ftrace/internal/bpf"
 	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
+	"github.com/hitzhangjie/go-ftrace/internal/record"
+	"github.com/hitzhangjie/go-ftrace/internal/tui"
 	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -19,48 +23,136 @@ import (
 // Tracer ELF bpf tracer
 type Tracer struct {
 	bin             string
+	pid             int
+	goids           []uint64
+	command         []string
 	elf             *elf.ELF
 	excludeVendor   bool
+	excludes        []string
 	uprobeWildcards []string
 	fetch           []string
-	drilldown       string
+	drilldown       []string
+	minDuration     time.Duration
+	assumeYes       bool
+	maxUprobes      int
+	duration        time.Duration
+	maxEvents       int
+	maxRoots        int
+	outputs         []string
+	outputOptions   outputOptions
+	record          string
+	tui             bool
 
 	bpf *bpf.BPF
 }
 
-// NewTracer create a new tracer for ELF executable `bin`, it attach uprobes listed in `uprobeWildcards`,
-// and output statistics of functions filtered by fetch
+// TracerOptions options to create a Tracer
+type TracerOptions struct {
+	Bin             string   // ELF executable to trace
+	Pid             int      // only trace the process `Pid`, `Bin` is resolved from /proc/<pid>/exe
+	Command         []string // start the command and only trace it, `Bin` is resolved from `Command[0]`
+	Goids           []uint64 // only trace these goroutines, filtered in the BPF programme
+	DebugFile       string   // separate file providing .symtab and DWARF of `Bin`
+	ExcludeVendor   bool     // exclude functions in vendor
+	Excludes        []string // wildcards of functions excluded from `UprobeWildcards`
+	UprobeWildcards []string // wildcards of functions to add uprobes
+	Fetch           []string // functions (and arguments) to trace
+	Drilldown       []string // wildcards of functions to only show their callstacks
+
+	AssumeYes  bool // attach uprobes without asking for confirmation
+	MaxUprobes int  // refuse to attach if more uprobes are found, 0 means no limit
+
+	Duration  time.Duration // stop tracing after the duration, 0 means no limit
+	MaxEvents int           // stop tracing after receiving so many events, 0 means no limit
+	MaxRoots  int           // stop tracing after printing so many completed root calls, 0 means no limit
+
+	MinDuration time.Duration // only show the callstacks whose root call took at least the duration
+
+	Outputs     []string // output specs, see eventmanager.NewOutput
+	OutputFile  string   // write the outputs to the file instead of stdout
+	Color       string   // color the text output: auto, always, never
+	RotateSize  int64    // rotate the output file if it exceeds the size, 0 means never rotate
+	RotateCount int      // number of rotated output files kept
+	Time        string   // timestamp mode of the text output: wall, relative, delta, none
+	Record      string   // record the events into the trace file instead of outputting, see record.Writer
+	TUI         bool     // browse the call trees in the terminal UI, see tui.UI
+}
+
+// NewTracer create a new tracer for ELF executable `opts.Bin`, it attach uprobes listed in `opts.UprobeWildcards`,
+// and output statistics of functions filtered by `opts.Fetch`
 //
-// `drilldown` means only show the callstack of the specified function.
-// TODO should we define it as a wildcast pattern, maybe a []string or []patterns?
-func NewTracer(bin string, excludeVendor bool, uprobeWildcards, fetch []string, drilldown string) (_ *Tracer, err error) {
-	elf, err := elf.New(bin)
+// `opts.Drilldown` means only show the callstacks of the functions matching the wildcards.
+func NewTracer(opts *TracerOptions) (_ *Tracer, err error) {
+	bin := opts.Bin
+	switch {
+	case opts.Pid != 0:
+		if bin, err = procExecutable(opts.Pid); err != nil {
+			return
+		}
+	case len(opts.Command) != 0:
+		if bin, err = lookupCommand(opts.Command); err != nil {
+			return
+		}
+	}
+
+	elf, err := elf.New(bin, opts.DebugFile)
 	if err != nil {
 		return
 	}
 
 	tracer := &Tracer{
 		bin:             bin,
+		pid:             opts.Pid,
+		goids:           opts.Goids,
+		command:         opts.Command,
 		elf:             elf,
-		excludeVendor:   excludeVendor,
-		uprobeWildcards: uprobeWildcards,
-		fetch:           fetch,
-		drilldown:       drilldown,
-		bpf:             bpf.New(),
+		excludeVendor:   opts.ExcludeVendor,
+		excludes:        opts.Excludes,
+		uprobeWildcards: opts.UprobeWildcards,
+		fetch:           opts.Fetch,
+		drilldown:       opts.Drilldown,
+		minDuration:     opts.MinDuration,
+		assumeYes:       opts.AssumeYes,
+		maxUprobes:      opts.MaxUprobes,
+		duration:        opts.Duration,
+		maxEvents:       opts.MaxEvents,
+		maxRoots:        opts.MaxRoots,
+		outputs:         opts.Outputs,
+		outputOptions: outputOptions{
+			File:        opts.OutputFile,
+			Color:       opts.Color,
+			RotateSize:  opts.RotateSize,
+			RotateCount: opts.RotateCount,
+			Time:        opts.Time,
+		},
+		record: opts.Record,
+		tui:    opts.TUI,
+		bpf:    bpf.New(),
 	}
 	return tracer, nil
 }
 
 // Parse parse the args `ftrace [flags] binary <args>`
 //
-// @return funcs    : the function names to trace
-// @return fetchArgs: the function name => parameters (parameter name => parameter <EA_expr>:<type>)
-// @return err      : return err if <args> is invalid
+// @return funcs     : the function names to trace
+// @return fetchArgs : the function name => parameters (parameter name => parameter <EA_expr>:<type>)
+// @return conditions: the function name => condition on the parameters to start a trace
+// @return err       : return err if <args> is invalid
 //
 // Here `EA_expr` is the expression of effective address, based on register and memory addressing mode.
-func (t *Tracer) Parse() (funcs []string, fetchArgs map[string]map[string]string, err error) {
+func (t *Tracer) Parse() (funcs []string, fetchArgs map[string]map[string]string, conditions map[string]string, err error) {
 	fetchArgs = map[string]map[string]string{}
+	conditions = map[string]string{}
 	for _, s := range t.fetch {
+		// see: main.handle(req.id=(+8(%ax)):u64) if req.id == 42
+		var cond string
+		if idx := strings.Index(s, ") if "); idx >= 0 {
+			s, cond = s[:idx+1], strings.TrimSpace(s[idx+len(") if "):])
+		} else if strings.Contains(s, " if ") {
+			err = fmt.Errorf("condition needs the fetched arguments: %s", s)
+			return
+		}
+
 		// see: main.(*Student).String
 		if s[len(s)-1] != ')' {
 			funcs = append(funcs, s)
@@ -90,6 +182,9 @@ func (t *Tracer) Parse() (funcs []string, fetchArgs map[string]map[string]string
 
 			funcname := s[:i]
 			fetchArgs[funcname] = map[string]string{}
+			if cond != "" {
+				conditions[funcname] = cond
+			}
 
 			// keep parsing the (s.name= , s.name.len= , s.age=...)
 			for _, part := range strings.Split(s[i+1:len(s)-1], ",") {
@@ -116,37 +211,85 @@ func (t *Tracer) Parse() (funcs []string, fetchArgs map[string]map[string]string
 	return
 }
 
-// Start start tracing
-func (t *Tracer) Start() (err error) {
-	funcs, fetchArgs, err := t.Parse()
+// parseOptions returns the options to select functions and parse uprobes
+func (t *Tracer) parseOptions() (_ *uprobe.ParseOptions, err error) {
+	funcs, fetchArgs, conditions, err := t.Parse()
 	if err != nil {
 		return
 	}
-	// parse uprobes
-	uprobes, err := uprobe.Parse(t.elf, &uprobe.ParseOptions{
+	return &uprobe.ParseOptions{
 		ExcludeVendor:   t.excludeVendor,
 		UprobeWildcards: t.uprobeWildcards,
+		Excludes:        t.excludes,
 		FuncNames:       funcs,
 		FetchFuncArgs:   fetchArgs,
-	})
+		FuncPredicates:  conditions,
+	}, nil
+}
+
+// Select returns the functions that would be traced (or skipped), without attaching any uprobes
+func (t *Tracer) Select() (_ []uprobe.Selection, err error) {
+	opts, err := t.parseOptions()
 	if err != nil {
 		return
 	}
+	return uprobe.Select(t.elf, opts)
+}
+
+// Start start tracing
+func (t *Tracer) Start() (err error) {
+	// PIE executable is loaded at a random address, the load bias differs
+	// from process to process, so we must know which process to trace.
+	if t.elf.IsPIE() && t.pid == 0 && len(t.command) == 0 {
+		return errors.New("PIE executable can only be traced with -p <pid> or -- <command>")
+	}
 
-	// let user confirm yes/no to trace
-requireConfirm:
-	fmt.Fprintf(os.Stdout, "found %d uprobes, large number of uprobes (>1000) need long time for attaching and detaching, continue? [Y/n]\n", len(uprobes))
-	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	var (
+		output eventmanager.Output
+		ui     *tui.UI
+	)
+	if t.record == "" {
+		if output, err = createOutput(t.outputs, t.outputOptions); err != nil {
+			return
+		}
+		if t.tui {
+			// closed first, it waits for the user to quit
+			ui = tui.New()
+			output = eventmanager.MultiOutput(ui, output)
+		}
+		defer func() {
+			if cerr := output.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	opts, err := t.parseOptions()
 	if err != nil {
-		return errors.WithStack(err)
+		return
 	}
-	switch strings.TrimSpace(input) {
-	case "n", "N":
+	// parse uprobes
+	uprobes, excluded, err := uprobe.Parse(t.elf, opts)
+	if err != nil {
 		return
-	case "y", "Y":
-		break
-	default:
-		goto requireConfirm
+	}
+
+	// check the uprobes budget, and let user confirm yes/no to trace
+	found := uprobesFound(len(uprobes), excluded)
+	if t.maxUprobes > 0 && len(uprobes) > t.maxUprobes {
+		fmt.Fprintf(os.Stderr, "found %s, exceeds the limit %d, top contributors:\n", found, t.maxUprobes)
+		for _, c := range uprobe.TopWildcards(uprobes, 10) {
+			fmt.Fprintf(os.Stderr, "  %6d  %s\n", c.Count, c.Wildcard)
+		}
+		return fmt.Errorf("too many uprobes: found %s, exceeds the limit %d", found, t.maxUprobes)
+	}
+	if t.assumeYes {
+		log.Infof("found %s", found)
+	} else {
+		var ok bool
+		if ok, err = confirm(found); err != nil || !ok {
+			return
+		}
 	}
 
 	// find the runtime.g->goid offset, and runtime.g offset to TLS
@@ -160,16 +303,58 @@ requireConfirm:
 	}
 	log.Debugf("offset of goid from g is %d, offset of g from fs is -0x%x\n", goidOffset, -gOffset)
 
+	// start the command, it stops before running any code until uprobes attached
+	var child *launcher
+	if len(t.command) != 0 {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		child = &launcher{}
+		if t.pid, err = child.start(t.bin, t.command); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil && child != nil {
+				child.kill()
+			}
+		}()
+	}
+
+	// PIE executable is loaded at a random address, compute the load bias
+	var loadBias uint64
+	if t.elf.IsPIE() {
+		if loadBias, err = t.elf.LoadBias(t.pid); err != nil {
+			return
+		}
+		log.Debugf("load bias of PIE executable is 0x%x", loadBias)
+	}
+
+	// record the events into trace file instead of outputting
+	var recorder *record.Writer
+	if t.record != "" {
+		if recorder, err = t.createRecord(uprobes, loadBias); err != nil {
+			return
+		}
+		defer func() {
+			if cerr := recorder.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
 	// load bpf programme and setup bpf programme config
 	if err = t.bpf.Load(uprobes, bpf.LoadOptions{
 		GoidOffset: goidOffset,
 		GOffset:    gOffset,
+		Pid:        t.pid,
+		LoadBias:   loadBias,
+		Goids:      t.goids,
 	}); err != nil {
 		return
 	}
 
 	// attach uprobes (and detach when exit)
-	if err = t.bpf.Attach(t.bin, uprobes); err != nil {
+	if err = t.bpf.Attach(t.bin, t.pid, uprobes); err != nil {
 		return
 	}
 
@@ -180,15 +365,188 @@ requireConfirm:
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	// and exit when the command exits
+	if child != nil {
+		if err = child.resume(); err != nil {
+			return
+		}
+		go func(child *launcher) {
+			child.wait()
+			stop()
+		}(child)
+		child = nil
+	}
+
+	// and exit when the session limits reached
+	if t.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.duration)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if recorder != nil {
+		return t.pollRecord(ctx, cancel, recorder, uprobes, loadBias)
+	}
+
 	// create eventmanager to poll events, prepare the callstack and print
-	eventManager, err := eventmanager.New(uprobes, t.drilldown, t.elf, t.bpf.PollArg(ctx))
+	eventManager, err := eventmanager.New(uprobes, t.elf, t.bpf.PollArg(ctx), eventmanager.Options{
+		Drilldown:   t.drilldown,
+		MinDuration: t.minDuration,
+		LoadBias:    loadBias,
+		Output:      output,
+	})
 	if err != nil {
 		return
 	}
+	// and exit when the user quits the UI
+	if ui != nil {
+		ui.Start()
+		go func() {
+			select {
+			case <-ui.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	if err = t.poll(ctx, cancel, eventManager.Handle, eventManager.Roots); err != nil {
+		return
+	}
+	return eventManager.PrintRemaining()
+}
+
+// poll polls the events and handles them by `handle` until `ctx` is done or
+// the session limits reached, `roots` returns the completed root calls printed.
+func (t *Tracer) poll(ctx context.Context, cancel context.CancelFunc, handle func(bpf.GoftraceEvent) error, roots func() int) (err error) {
+	var (
+		events  int
+		limited bool
+	)
 	for event := range t.bpf.PollEvents(ctx) {
-		if err = eventManager.Handle(event); err != nil {
+		// keep draining the events until the poller stops
+		if limited {
+			continue
+		}
+		if err = handle(event); err != nil {
 			return
 		}
+		events++
+		if t.maxEvents > 0 && events >= t.maxEvents {
+			log.Infof("stop tracing, received %d events", events)
+			limited = true
+		}
+		if t.maxRoots > 0 && roots != nil && roots() >= t.maxRoots {
+			log.Infof("stop tracing, printed %d root calls", roots())
+			limited = true
+		}
+		if limited {
+			cancel()
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Infof("stop tracing, traced for %v", t.duration)
+	}
+	return
+}
+
+// pollRecord records the events into the trace file by `recorder`, and counts
+// the completed root calls (which took at least the min duration) like
+// printing them to stop at the max roots.
+func (t *Tracer) pollRecord(ctx context.Context, cancel context.CancelFunc, recorder *record.Writer, uprobes []uprobe.Uprobe, loadBias uint64) error {
+	if t.maxRoots == 0 {
+		recorder.WriteArgs(t.bpf.PollArg(ctx))
+		return t.poll(ctx, cancel, recorder.WriteEvent, nil)
+	}
+
+	// both need the fetched arguments
+	recordArgs, countArgs := make(chan bpf.GoftraceArgData), make(chan bpf.GoftraceArgData)
+	go func() {
+		defer close(recordArgs)
+		defer close(countArgs)
+		for arg := range t.bpf.PollArg(ctx) {
+			recordArgs <- arg
+			countArgs <- arg
+		}
+	}()
+	recorder.WriteArgs(recordArgs)
+
+	counter, err := eventmanager.New(uprobes, t.elf, countArgs, eventmanager.Options{
+		MinDuration: t.minDuration,
+		LoadBias:    loadBias,
+		Output:      eventmanager.MultiOutput(),
+	})
+	if err != nil {
+		return err
+	}
+	return t.poll(ctx, cancel, func(event bpf.GoftraceEvent) error {
+		if err := recorder.WriteEvent(event); err != nil {
+			return err
+		}
+		return counter.Handle(event)
+	}, counter.Roots)
+}
+
+// createRecord creates the trace file to record the events
+func (t *Tracer) createRecord(uprobes []uprobe.Uprobe, loadBias uint64) (*record.Writer, error) {
+	bootTime, err := eventmanager.MonotonicEpoch()
+	if err != nil {
+		return nil, err
+	}
+	gnuBuildID, goBuildID := t.elf.BuildID()
+	return record.Create(t.record, &record.Header{
+		Binary:      t.bin,
+		GNUBuildID:  gnuBuildID,
+		GoBuildID:   goBuildID,
+		Pid:         t.pid,
+		LoadBias:    loadBias,
+		BootTime:    bootTime,
+		StartTime:   time.Now(),
+		Uprobes:     uprobes,
+		MinDuration: t.minDuration,
+	}, t.elf)
+}
+
+// procExecutable returns the path to the executable of process `pid`.
+//
+// /proc/<pid>/exe is used instead of the link target, it always refers to
+// the running executable even if it's in another mount namespace or has
+// been replaced on the disk.
+func procExecutable(pid int) (bin string, err error) {
+	bin = fmt.Sprintf("/proc/%d/exe", pid)
+	target, err := os.Readlink(bin)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolve executable of process %d", pid)
+	}
+	log.Infof("trace process %d, executable: %s", pid, target)
+	return bin, nil
+}
+
+// uprobesFound describes the `n` uprobes found, and the `excluded` functions
+// matching the wildcards but excluded, like: 10 uprobes (2 matched functions excluded)
+func uprobesFound(n, excluded int) string {
+	found := fmt.Sprintf("%d uprobes", n)
+	if excluded > 0 {
+		found += fmt.Sprintf(" (%d matched functions excluded)", excluded)
+	}
+	return found
+}
+
+// confirm asks user whether to attach the uprobes `found` or not, see uprobesFound
+func confirm(found string) (bool, error) {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "found %s, large number of uprobes (>1000) need long time for attaching and detaching, continue? [Y/n]\n", found)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		switch strings.TrimSpace(input) {
+		case "n", "N":
+			return false, nil
+		case "y", "Y":
+			return true, nil
+		}
 	}
-	return eventManager.PrintRemaining()
 }
@@ -0,0 +1,12 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_UprobesFound(t *testing.T) {
+	require.Equal(t, "10 uprobes", uprobesFound(10, 0))
+	require.Equal(t, "10 uprobes (2 matched functions excluded)", uprobesFound(10, 2))
+}
@@ -0,0 +1,126 @@
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DebugDir is the directory where debug files are installed, a debug file
+// is looked up by the GNU build ID, like: .build-id/ab/cdef1234.debug, or
+// by the Go build ID reported by `go tool buildid`, like:
+// .build-id/go/<action ID>/<content ID>.debug
+var DebugDir = "/usr/lib/debug"
+
+const (
+	ntGNUBuildID = 3 // NT_GNU_BUILD_ID in .note.gnu.build-id
+	ntGoBuildID  = 4 // note type in .note.go.buildid
+)
+
+// BuildID returns the GNU build ID (hex encoded) and Go build ID of ELF file,
+// empty if not found.
+//
+// Go linker doesn't emit GNU build ID by default before go1.24, build with
+// `-ldflags=-B=gobuildid` to derive one from the Go build ID.
+func BuildID(f *elf.File) (gnu, golang string) {
+	if desc := readNote(f, ".note.gnu.build-id", "GNU", ntGNUBuildID); desc != nil {
+		gnu = hex.EncodeToString(desc)
+	}
+	if desc := readNote(f, ".note.go.buildid", "Go", ntGoBuildID); desc != nil {
+		golang = string(desc)
+	}
+	return
+}
+
+// readNote returns the descriptor of the note with `name` and `typ` in section `section`
+func readNote(f *elf.File, section, name string, typ uint32) []byte {
+	s := f.Section(section)
+	if s == nil || s.Type != elf.SHT_NOTE {
+		return nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil
+	}
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		namesz := f.ByteOrder.Uint32(data[0:4])
+		descsz := f.ByteOrder.Uint32(data[4:8])
+		ntype := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+		if uint32(len(data)) < align(namesz)+descsz {
+			return nil
+		}
+		nname := string(bytes.TrimRight(data[:namesz], "\x00"))
+		desc := data[align(namesz) : align(namesz)+descsz]
+		if nname == name && ntype == typ {
+			return desc
+		}
+		if uint32(len(data)) < align(namesz)+align(descsz) {
+			return nil
+		}
+		data = data[align(namesz)+align(descsz):]
+	}
+	return nil
+}
+
+// LookupDebugFile returns the debug file of ELF file under DebugDir by its
+// GNU build ID, or by its Go build ID, empty if not found.
+func LookupDebugFile(f *elf.File) string {
+	gnu, golang := BuildID(f)
+	var paths []string
+	if len(gnu) > 2 {
+		paths = append(paths, filepath.Join(DebugDir, ".build-id", gnu[:2], gnu[2:]+".debug"))
+	}
+	if golang != "" {
+		paths = append(paths, filepath.Join(DebugDir, ".build-id", "go", golang+".debug"))
+	}
+	if len(paths) == 0 {
+		log.Warnf("build ID not found, can't look up the debug file, specify it by --debug-file")
+		return ""
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		log.Debugf("debug file %s not found", path)
+	}
+	return ""
+}
+
+// openDebugFile opens the debug file `path`, and verifies that its build ID
+// matches the executable `f`.
+func openDebugFile(f *elf.File, path string) (_ *elf.File, err error) {
+	debugFile, err := elf.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			debugFile.Close()
+		}
+	}()
+
+	gnu, golang := BuildID(f)
+	debugGnu, debugGolang := BuildID(debugFile)
+	if gnu == "" && golang == "" && debugGnu == "" && debugGolang == "" {
+		log.Warnf("build ID not found, can't verify the debug file %s", path)
+		return debugFile, nil
+	}
+	if gnu != debugGnu || golang != debugGolang {
+		return nil, fmt.Errorf("build ID mismatch: executable has GNU %q Go %q, but %s has GNU %q Go %q",
+			gnu, golang, path, debugGnu, debugGolang)
+	}
+	return debugFile, nil
+}
+
+// BuildID returns the GNU build ID (hex encoded) and Go build ID of the executable
+func (e *ELF) BuildID() (gnu, golang string) {
+	return BuildID(e.elfFile)
+}
@@ -0,0 +1,106 @@
+package elf
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildGo builds a main package printing `msg` with `ldflags`, and returns the executable
+func buildGo(t *testing.T, msg, ldflags string) string {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module main\n\ngo 1.20\n"), 0644))
+	src := "package main\n\nfunc main() { println(\"" + msg + "\") }\n"
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0644))
+
+	bin := filepath.Join(dir, "main")
+	cmd := exec.Command(goBin, "build", "-o", bin, "-ldflags="+ldflags)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.Nil(t, err, string(out))
+	return bin
+}
+
+// goToolBuildID returns the Go build ID of `bin` reported by `go tool buildid`
+func goToolBuildID(t *testing.T, bin string) string {
+	out, err := exec.Command("go", "tool", "buildid", bin).Output()
+	require.Nil(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+// installDebugFile links `bin` as the debug file `name` under DebugDir/.build-id
+func installDebugFile(t *testing.T, bin, name string) string {
+	path := filepath.Join(DebugDir, ".build-id", name)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, os.Symlink(bin, path))
+	return path
+}
+
+func Test_BuildID(t *testing.T) {
+	bin := buildGo(t, "hello", "-B gobuildid")
+	f, err := elf.Open(bin)
+	require.Nil(t, err)
+	defer f.Close()
+
+	gnu, golang := BuildID(f)
+	require.Equal(t, goToolBuildID(t, bin), golang)
+	require.Len(t, gnu, 40)
+
+	// a note is matched by both the owner and the type
+	require.Nil(t, readNote(f, ".note.go.buildid", "GNU", ntGoBuildID))
+	require.Nil(t, readNote(f, ".note.go.buildid", "Go", ntGNUBuildID))
+	require.Nil(t, readNote(f, ".text", "Go", ntGoBuildID))
+}
+
+func Test_LookupDebugFile(t *testing.T) {
+	defer func(dir string) { DebugDir = dir }(DebugDir)
+	DebugDir = t.TempDir()
+
+	// by GNU build ID
+	bin := buildGo(t, "gnu", "-B gobuildid")
+	f, err := elf.Open(bin)
+	require.Nil(t, err)
+	defer f.Close()
+	require.Equal(t, "", LookupDebugFile(f))
+	gnu, _ := BuildID(f)
+	path := installDebugFile(t, bin, gnu[:2]+"/"+gnu[2:]+".debug")
+	require.Equal(t, path, LookupDebugFile(f))
+
+	// by Go build ID, if there's no GNU build ID (go1.24+ emits one unless -B none)
+	bin = buildGo(t, "go", "-B none")
+	f, err = elf.Open(bin)
+	require.Nil(t, err)
+	defer f.Close()
+	gnu, golang := BuildID(f)
+	require.Equal(t, "", gnu)
+	require.Equal(t, "", LookupDebugFile(f))
+	path = installDebugFile(t, bin, "go/"+goToolBuildID(t, bin)+".debug")
+	require.Equal(t, path, LookupDebugFile(f))
+	require.Contains(t, path, golang)
+}
+
+func Test_OpenDebugFile(t *testing.T) {
+	bin := buildGo(t, "hello", "-B gobuildid")
+	f, err := elf.Open(bin)
+	require.Nil(t, err)
+	defer f.Close()
+
+	debugFile, err := openDebugFile(f, bin)
+	require.Nil(t, err)
+	debugFile.Close()
+
+	// the build IDs of another build differ
+	_, err = openDebugFile(f, buildGo(t, "world", "-B gobuildid"))
+	require.ErrorContains(t, err, "build ID mismatch")
+	_, err = openDebugFile(f, buildGo(t, "hello", "-B none"))
+	require.ErrorContains(t, err, "build ID mismatch")
+}
@@ -13,6 +13,9 @@ func (e *ELF) IterDebugInfo() <-chan *dwarf.Entry {
 	ch := make(chan *dwarf.Entry)
 	go func() {
 		defer close(ch)
+		if e.dwarfData == nil {
+			return
+		}
 		infoReader := e.dwarfData.Reader()
 		for {
 			entry, err := infoReader.Next()
@@ -116,6 +119,7 @@ func (e *ELF) LineEntries() (lineEntries []dwarf.LineEntry, err error) {
 				entry := dwarf.LineEntry{}
 				if err = lineReader.Next(&entry); err != nil {
 					if err == io.EOF {
+						err = nil
 						break
 					}
 					return
@@ -131,18 +135,66 @@ func (e *ELF) LineEntries() (lineEntries []dwarf.LineEntry, err error) {
 
 // LineInfoForPc returns the filename and line number of pc in ELF file
 func (e *ELF) LineInfoForPc(pc uint64) (filename string, line int, err error) {
+	if !e.HasDWARF() {
+		// pc is a return address, the call instruction is right before it
+		return e.pclnLineInfo(pc - 1)
+	}
 	lineEntries, err := e.LineEntries()
 	if err != nil {
 		return
 	}
 	idx := sort.Search(len(lineEntries), func(i int) bool { return lineEntries[i].Address >= pc }) - 1
+	if idx < 0 {
+		err = errors.Wrapf(SymbolNotFoundError, "line info of %x", pc)
+		return
+	}
+	return lineEntries[idx].File.Name, lineEntries[idx].Line, nil
+}
+
+// pclnLineInfo returns the filename and line number of pc by .gopclntab
+func (e *ELF) pclnLineInfo(pc uint64) (filename string, line int, err error) {
+	table, err := e.PclnTable()
+	if err != nil {
+		return
+	}
+	filename, line, fn := table.PCToLine(pc)
+	if fn == nil {
+		err = errors.Wrapf(SymbolNotFoundError, "line info of %x", pc)
+	}
+	return
+}
+
+// FuncLineInfo returns the filename and line number of the entry of function `funcname` in ELF file
+func (e *ELF) FuncLineInfo(funcname string) (filename string, line int, err error) {
+	sym, err := e.ResolveSymbol(funcname)
+	if err != nil {
+		return
+	}
+	if !e.HasDWARF() {
+		return e.pclnLineInfo(sym.Value)
+	}
+	lineEntries, err := e.LineEntries()
+	if err != nil {
+		return
+	}
+	// unlike LineInfoForPc, which is used for return addresses, we want the
+	// line entry covering the entry pc itself.
+	idx := sort.Search(len(lineEntries), func(i int) bool { return lineEntries[i].Address > sym.Value }) - 1
+	if idx < 0 {
+		err = errors.Wrapf(SymbolNotFoundError, "line info of %s", funcname)
+		return
+	}
 	return lineEntries[idx].File.Name, lineEntries[idx].Line, nil
 }
 
 // FindGoidOffset returns the offset of the goid in runtime.g struct.
 //
-// find DIE runtime.g, then find its member Attribute 'goid'.
+// find DIE runtime.g, then find its member Attribute 'goid'. If DWARF is
+// stripped, the offset is determined by the Go version.
 func (e *ELF) FindGoidOffset() (int64, error) {
+	if !e.HasDWARF() {
+		return e.goidOffsetByVersion()
+	}
 	foundRuntimeG := false
 	for die := range e.IterDebugInfo() {
 		switch die.Tag {
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	log "github.com/sirupsen/logrus"
 )
 
 // ELF ELF file
@@ -13,13 +14,18 @@ type ELF struct {
 	bin       string
 	binFile   *os.File
 	elfFile   *elf.File
-	dwarfData *dwarf.Data
+	symFile   *elf.File   // file providing .symtab and DWARF, elfFile or the separate debug file
+	dwarfData *dwarf.Data // nil if DWARF is stripped
 
 	cache map[string]interface{}
 }
 
 // New create a new ELF file
-func New(bin string) (_ *ELF, err error) {
+//
+// `debugFile` is the separate file providing .symtab and DWARF, e.g. the
+// unstripped build artifact of `bin`. If it's empty and `bin` is stripped,
+// the debug file is looked up by build ID, see LookupDebugFile.
+func New(bin string, debugFile string) (_ *ELF, err error) {
 	binFile, err := os.Open(bin)
 	if err != nil {
 		return
@@ -28,6 +34,38 @@ func New(bin string) (_ *ELF, err error) {
 	if err != nil {
 		return
 	}
+	e := &ELF{
+		bin:     bin,
+		binFile: binFile,
+		elfFile: elfFile,
+		symFile: elfFile,
+		cache:   map[string]interface{}{},
+	}
+
+	stripped := elfFile.Section(".symtab") == nil ||
+		(elfFile.Section(".debug_info") == nil && elfFile.Section(".zdebug_info") == nil)
+	if debugFile == "" && stripped {
+		debugFile = LookupDebugFile(elfFile)
+	}
+	if debugFile != "" {
+		if e.symFile, err = openDebugFile(elfFile, debugFile); err != nil {
+			return
+		}
+		log.Infof("load symbols and DWARF from %s", debugFile)
+	}
+
+	if e.dwarfData, err = loadDWARF(e.symFile); err != nil {
+		return
+	}
+	if e.dwarfData == nil {
+		// stripped by `-ldflags=-w`, fallback to .gopclntab, see pclntab.go
+		log.Debugf("DWARF not found in %s, fallback to .gopclntab", bin)
+	}
+	return e, nil
+}
+
+// loadDWARF loads the DWARF data in ELF file, it returns nil if DWARF is stripped
+func loadDWARF(elfFile *elf.File) (_ *dwarf.Data, err error) {
 	abbrev, err := godwarf.GetDebugSectionElf(elfFile, "abbrev")
 	if err != nil {
 		abbrev = nil
@@ -38,13 +76,14 @@ func New(bin string) (_ *ELF, err error) {
 	}
 	frame, err := godwarf.GetDebugSectionElf(elfFile, "frame")
 	if err != nil {
-		section := elfFile.Section(".eh_frame")
-		frame = make([]byte, section.Size)
-		_, err = binFile.ReadAt(frame, int64(section.Offset))
+		frame = nil
+		if section := elfFile.Section(".eh_frame"); section != nil {
+			frame, _ = section.Data()
+		}
 	}
 	info, err := godwarf.GetDebugSectionElf(elfFile, "info")
 	if err != nil {
-		info = nil
+		return nil, nil
 	}
 	line, err := godwarf.GetDebugSectionElf(elfFile, "line")
 	if err != nil {
@@ -67,11 +106,15 @@ func New(bin string) (_ *ELF, err error) {
 		println("...")
 		return
 	}
-	return &ELF{
-		bin:       bin,
-		binFile:   binFile,
-		elfFile:   elfFile,
-		dwarfData: dwarfData,
-		cache:     map[string]interface{}{},
-	}, nil
+	// DWARF 5 sections, Go emits DWARF 5 since go1.25
+	for _, name := range []string{"addr", "line_str", "str_offsets", "rnglists"} {
+		data, err := godwarf.GetDebugSectionElf(elfFile, name)
+		if err != nil {
+			continue
+		}
+		if err = dwarfData.AddSection(".debug_"+name, data); err != nil {
+			return nil, err
+		}
+	}
+	return dwarfData, nil
 }
@@ -1,6 +1,10 @@
 package elf
 
-import "debug/elf"
+import (
+	"debug/elf"
+
+	"github.com/pkg/errors"
+)
 
 // Section returns the ELF section with the given name.
 func (f *ELF) Section(s string) *elf.Section {
@@ -15,10 +19,20 @@ func (f *ELF) SectionBytes(s string) (bytes []byte, err error) {
 	return
 }
 
-// AddressToOffset converts an address to an offset in the ELF file.
+// AddressToOffset converts a link-time address to an offset in the ELF file.
+//
+// For PIE executables, the address must be the link-time address, i.e. the
+// runtime address minus the load bias, see LoadBias.
 func (f *ELF) AddressToOffset(addr uint64) (offset uint64, err error) {
-	textSection := f.Section(".text")
-	return addr - textSection.Addr, nil
+	for _, prog := range f.elfFile.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if addr >= prog.Vaddr && addr < prog.Vaddr+prog.Filesz {
+			return addr - prog.Vaddr + prog.Off, nil
+		}
+	}
+	return 0, errors.Wrapf(SymbolNotFoundError, "no segment contains address %x", addr)
 }
 
 // Prog returns the ELF program with the given type.
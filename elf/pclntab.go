@@ -0,0 +1,121 @@
+package elf
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/gosym"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HasDWARF reports whether the ELF file contains DWARF debug info, it's
+// stripped if built with `-ldflags=-w`.
+func (e *ELF) HasDWARF() bool {
+	return e.dwarfData != nil
+}
+
+// PclnTable returns the Go symbol table built from .gopclntab, which is
+// kept by the linker even if the binary is stripped by `-ldflags=-s -w`.
+func (e *ELF) PclnTable() (table *gosym.Table, err error) {
+	if v, ok := e.cache["pclntab"]; ok {
+		return v.(*gosym.Table), nil
+	}
+
+	section := e.Section(".gopclntab")
+	if section == nil {
+		return nil, errors.Wrap(SymbolNotFoundError, ".gopclntab")
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	text := e.Section(".text")
+	if text == nil {
+		return nil, errors.Wrap(SymbolNotFoundError, ".text")
+	}
+	if table, err = gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	e.cache["pclntab"] = table
+	return table, nil
+}
+
+// pclntabSymbols returns the function symbols built from .gopclntab, it's
+// used when .symtab is stripped.
+func (e *ELF) pclntabSymbols() (symbols []elf.Symbol, err error) {
+	table, err := e.PclnTable()
+	if err != nil {
+		return
+	}
+	var textIndex elf.SectionIndex
+	for i, section := range e.elfFile.Sections {
+		if section.Name == ".text" {
+			textIndex = elf.SectionIndex(i)
+			break
+		}
+	}
+	for _, fn := range table.Funcs {
+		symbols = append(symbols, elf.Symbol{
+			Name:    fn.Name,
+			Info:    elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC),
+			Section: textIndex,
+			Value:   fn.Entry,
+			Size:    fn.End - fn.Entry,
+		})
+	}
+	return
+}
+
+// GoVersion returns the minor version of Go toolchain building the ELF file,
+// e.g. 22 for go1.22.1, it's read from .go.buildinfo which is never stripped.
+func (e *ELF) GoVersion() (minor int, err error) {
+	info, err := buildinfo.Read(e.binFile)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	// go1.22.1, go1.23rc1, devel go1.24-abcdef ...
+	idx := strings.Index(info.GoVersion, "go1.")
+	if idx < 0 {
+		return 0, errors.Errorf("invalid go version %s", info.GoVersion)
+	}
+	version := info.GoVersion[idx+len("go1."):]
+	if idx := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' }); idx >= 0 {
+		version = version[:idx]
+	}
+	if minor, err = strconv.Atoi(version); err != nil {
+		return 0, errors.Wrapf(err, "invalid go version %s", info.GoVersion)
+	}
+	return minor, nil
+}
+
+// goidOffsets are the offsets of goid in runtime.g on amd64 by Go version,
+// read from DWARF of the binaries built by each toolchain.
+var goidOffsets = []struct {
+	from, to int // minor versions, inclusive
+	offset   int64
+}{
+	{9, 22, 152},
+	{23, 24, 160}, // g.syscallbp added in go1.23
+	{25, 27, 152}, // gobuf.ret removed in go1.25
+}
+
+// goidOffsetByVersion returns the offset of goid in runtime.g when DWARF is
+// stripped, it's an error if the Go version is not known.
+func (e *ELF) goidOffsetByVersion() (int64, error) {
+	minor, err := e.GoVersion()
+	if err != nil {
+		return 0, err
+	}
+	return goidOffsetOf(minor)
+}
+
+func goidOffsetOf(minor int) (int64, error) {
+	for _, v := range goidOffsets {
+		if minor >= v.from && minor <= v.to {
+			return v.offset, nil
+		}
+	}
+	return 0, errors.Errorf("goid offset unknown for go1.%d without DWARF, try a debug file with DWARF", minor)
+}
@@ -0,0 +1,45 @@
+package elf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GoidOffsetOf(t *testing.T) {
+	for _, tt := range []struct {
+		minor  int
+		offset int64
+	}{
+		{9, 152},
+		{20, 152},
+		{22, 152},
+		{23, 160},
+		{24, 160},
+		{25, 152},
+		{27, 152},
+	} {
+		offset, err := goidOffsetOf(tt.minor)
+		require.Nil(t, err, "go1.%d", tt.minor)
+		require.Equal(t, tt.offset, offset, "go1.%d", tt.minor)
+	}
+	for _, minor := range []int{8, 28} {
+		_, err := goidOffsetOf(minor)
+		require.NotNil(t, err, "go1.%d", minor)
+	}
+}
+
+func Test_GoidOffsetOfDWARF(t *testing.T) {
+	e, err := New(os.Args[0], "")
+	require.Nil(t, err)
+	minor, err := e.GoVersion()
+	require.Nil(t, err)
+
+	// the offset by version must agree with DWARF of the toolchain running the test
+	want, err := e.FindGoidOffset()
+	require.Nil(t, err)
+	offset, err := goidOffsetOf(minor)
+	require.Nil(t, err, "add go1.%d to goidOffsets", minor)
+	require.Equal(t, want, offset)
+}
@@ -0,0 +1,76 @@
+package elf
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// IsPIE reports whether the ELF file is a position independent executable,
+// which is loaded at a random address, so runtime addresses differ from the
+// link-time addresses in .symtab and DWARF by the load bias.
+func (e *ELF) IsPIE() bool {
+	return e.elfFile.Type == elf.ET_DYN
+}
+
+// LoadBias returns the load bias of the ELF file in process `pid`, that is:
+//
+//	runtime address = link-time address + load bias
+//
+// The bias is computed from the executable mapping in /proc/<pid>/maps.
+func (e *ELF) LoadBias(pid int) (bias uint64, err error) {
+	if !e.IsPIE() {
+		return 0, nil
+	}
+
+	st, err := os.Stat(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	inode := st.Sys().(*syscall.Stat_t).Ino
+
+	fin, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer fin.Close()
+
+	// line like: 55d0c5a00000-55d0c5b2c000 r-xp 00001000 08:01 1234567 /path/to/exe
+	scanner := bufio.NewScanner(fin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		if ino, err := strconv.ParseUint(fields[4], 10, 64); err != nil || ino != inode {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.Split(fields[0], "-")[0], 16, 64)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		off, err := strconv.ParseUint(fields[2], 16, 64)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		for _, prog := range e.elfFile.Progs {
+			if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_X == 0 {
+				continue
+			}
+			if off < prog.Off&^(prog.Align-1) || off >= prog.Off+prog.Filesz {
+				continue
+			}
+			return start - off - (prog.Vaddr - prog.Off), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return 0, fmt.Errorf("executable mapping not found in process %d", pid)
+}
@@ -9,13 +9,21 @@ import (
 )
 
 // Symbols returns the symbols in .symtab section, and a map from symbol name to symbol.
+//
+// .symtab is read from the separate debug file if there's one.
 func (e *ELF) Symbols() (symbols []elf.Symbol, symnames map[string]elf.Symbol, err error) {
 	if _, ok := e.cache["symbols"]; ok {
 		return e.cache["symbols"].([]elf.Symbol), e.cache["symnames"].(map[string]elf.Symbol), nil
 	}
 
-	if symbols, err = e.elfFile.Symbols(); err != nil {
-		return
+	if symbols, err = e.symFile.Symbols(); err != nil {
+		// stripped by `-ldflags=-s`, fallback to .gopclntab
+		if !errors.Is(err, elf.ErrNoSymbols) {
+			return
+		}
+		if symbols, err = e.pclntabSymbols(); err != nil {
+			return
+		}
 	}
 
 	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Value < symbols[j].Value })
@@ -78,8 +86,7 @@ func (e *ELF) FuncOffset(name string) (offset uint64, err error) {
 	if err != nil {
 		return
 	}
-	section := e.Section(".text")
-	return sym.Value - section.Addr + section.Offset, nil
+	return e.AddressToOffset(sym.Value)
 }
 
 // FuncPcRangeInSymtab returns the lowpc and highpc of function `name` in .symtab section.
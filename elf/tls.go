@@ -1,6 +1,11 @@
 package elf
 
-import "debug/elf"
+import (
+	"debug/elf"
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 // FindGOffset returns the runtime.g offset
 //
@@ -41,5 +46,29 @@ func (e *ELF) FindGOffset() (offset int64, err error) {
 		return int64(^(memsz) + 1 + tlsg.Value), nil
 	}
 	// While inner linking, it's a fixed value -8 ... at least on x86+linux.
+	//
+	// But it's unknown without runtime.tlsg when external linking (like cgo),
+	// e.g. .symtab is stripped by `-ldflags=-s`, -8 reads garbage as g.
+	if e.externalLinked() {
+		return 0, errors.New("runtime.tlsg not found in the externally linked (cgo) executable, " +
+			"can't locate runtime.g, trace the unstripped binary or specify --debug-file")
+	}
 	return -8, nil
 }
+
+// externalLinked reports whether the executable is linked by the external
+// linker, which starts it by the C runtime like _start, instead of the Go
+// entry _rt0_<arch>_<os>.
+func (e *ELF) externalLinked() bool {
+	syms, _, err := e.ResolveAddress(e.elfFile.Entry)
+	if err != nil {
+		// the C runtime isn't in .gopclntab
+		return true
+	}
+	for _, sym := range syms {
+		if strings.HasPrefix(sym.Name, "_rt0_") {
+			return false
+		}
+	}
+	return true
+}
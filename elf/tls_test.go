@@ -0,0 +1,40 @@
+package elf
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FindGOffset(t *testing.T) {
+	for _, c := range []struct {
+		ldflags string
+		offset  int64
+		err     string
+	}{
+		{ldflags: "", offset: -8},
+		{ldflags: "-s", offset: -8},
+		// runtime.tlsg is relocated to the TLS block of the external linker
+		{ldflags: "-linkmode=external"},
+		{ldflags: "-linkmode=external -s", err: "runtime.tlsg not found"},
+	} {
+		if _, err := exec.LookPath("gcc"); err != nil && strings.Contains(c.ldflags, "external") {
+			continue
+		}
+		e, err := New(buildGo(t, "hello", c.ldflags), "")
+		require.Nil(t, err, c.ldflags)
+		offset, err := e.FindGOffset()
+		if c.err != "" {
+			require.ErrorContains(t, err, c.err, c.ldflags)
+			continue
+		}
+		require.Nil(t, err, c.ldflags)
+		if c.offset != 0 {
+			require.Equal(t, c.offset, offset, c.ldflags)
+		} else {
+			require.Less(t, offset, int64(0), c.ldflags)
+		}
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
 )
@@ -16,6 +19,10 @@ import (
 const (
 	EventDataOffset int64 = 436
 	VacantR10Offset       = -96
+
+	// verifierLogSize is large enough for the log of the predicates and arg
+	// fetching, or loading fails with ENOSPC
+	verifierLogSize = ebpf.DefaultVerifierLogSize * 4
 )
 
 var RegisterConstants = map[string]uint8{
@@ -40,26 +47,36 @@ var RegisterConstants = map[string]uint8{
 type LoadOptions struct {
 	GoidOffset int64
 	GOffset    int64
+	Pid        int      // only trace the process `Pid` if it's not 0
+	LoadBias   uint64   // load bias of PIE executable, runtime address = uprobe.Address + LoadBias
+	Goids      []uint64 // only trace these goroutines if not empty, see TraceGoids
 }
 
 type BPF struct {
 	objs    *GoftraceObjects
+	links   []io.Closer // attached uprobes
 	closers []io.Closer
+
+	detachOnce sync.Once
 }
 
 func New() *BPF {
 	return &BPF{}
 }
 
-func (b *BPF) BpfConfig(fetchArgs bool, goidOffset, gOffset int64) interface{} {
+func (b *BPF) BpfConfig(fetchArgs, filterGoid bool, goidOffset, gOffset int64, tgid uint32) interface{} {
 	return struct {
 		GoidOffset, GOffset int64
+		Tgid                uint32
 		FetchArgs           bool
-		Padding             [7]byte
+		FilterGoid          bool
+		Padding             [2]byte
 	}{
 		GoidOffset: goidOffset,
 		GOffset:    gOffset,
+		Tgid:       tgid,
 		FetchArgs:  fetchArgs,
+		FilterGoid: filterGoid,
 	}
 }
 
@@ -85,24 +102,32 @@ func (b *BPF) Load(uprobes []uprobe.Uprobe, opts LoadOptions) (err error) {
 			break
 		}
 	}
-	cfg := b.BpfConfig(fetchArgs, opts.GoidOffset, opts.GOffset)
+	cfg := b.BpfConfig(fetchArgs, len(opts.Goids) > 0, opts.GoidOffset, opts.GOffset, uint32(opts.Pid))
 	if err = spec.RewriteConstants(map[string]interface{}{"CONFIG": cfg}); err != nil {
 		return
 	}
 	if err = spec.LoadAndAssign(b.objs, &ebpf.CollectionOptions{
-		Programs: ebpf.ProgramOptions{LogSize: ebpf.DefaultVerifierLogSize * 4},
+		Programs: ebpf.ProgramOptions{LogSize: verifierLogSize},
 	}); err != nil {
 		return
 	}
 
+	if err = b.TraceGoids(opts.Goids...); err != nil {
+		return
+	}
 	for _, uprobe := range uprobes {
 		if len(uprobe.FetchArgs) > 0 {
-			if err = b.setArgRules(uprobe.Address, uprobe.FetchArgs); err != nil {
+			if err = b.setArgRules(uprobe.Address+opts.LoadBias, uprobe.FetchArgs); err != nil {
+				return
+			}
+		}
+		if len(uprobe.Predicates) > 0 {
+			if err = b.setArgPredicates(uprobe.Address+opts.LoadBias, uprobe.FetchArgs, uprobe.Predicates); err != nil {
 				return
 			}
 		}
 		if uprobe.Wanted {
-			if err = b.setWanted(uprobe); err != nil {
+			if err = b.setWanted(uprobe.Address + opts.LoadBias); err != nil {
 				return
 			}
 		}
@@ -137,16 +162,71 @@ func (b *BPF) setArgRules(pc uint64, fetchArgs []*uprobe.FetchArg) (err error) {
 			}
 		}
 		argRules.Rules[idx] = rule
-		fmt.Printf("add arg rule at %x: %+v\n", pc, rule)
+		log.Debugf("add arg rule at %x: %+v", pc, rule)
 	}
 	return b.objs.ArgRulesMap.Update(pc, argRules, ebpf.UpdateNoExist)
 }
 
-func (b *BPF) setWanted(uprobe uprobe.Uprobe) (err error) {
-	return b.objs.ShouldTraceRip.Update(uprobe.Address, true, ebpf.UpdateNoExist)
+func (b *BPF) setArgPredicates(pc uint64, fetchArgs []*uprobe.FetchArg, predicates []*uprobe.Predicate) (err error) {
+	if len(predicates) > 4 {
+		return fmt.Errorf("too many predicates: %d > 4", len(predicates))
+	}
+	argPredicates := GoftraceArgPredicates{Length: uint8(len(predicates))}
+	for idx, p := range predicates {
+		arg := fetchArgs[p.Arg]
+		pred := GoftraceArgPredicate{
+			Arg:    uint8(p.Arg),
+			Op:     uint8(p.Op),
+			Size:   uint8(arg.Size),
+			LenArg: 0xff,
+			Value:  p.Value,
+		}
+		if p.LenArg >= 0 {
+			pred.LenArg = uint8(p.LenArg)
+		}
+		switch arg.Type[0] {
+		case 'u':
+			pred.Type = 0
+		case 's':
+			pred.Type = 1
+		case 'c':
+			pred.Type = 2
+			pred.Size = uint8(copy(pred.Data[:], p.Data))
+		}
+		argPredicates.Predicates[idx] = pred
+		log.Debugf("add arg predicate at %x: %s", pc, p.Statement)
+	}
+	return b.objs.ArgPredicatesMap.Update(pc, argPredicates, ebpf.UpdateNoExist)
 }
 
-func (b *BPF) Attach(bin string, uprobes []uprobe.Uprobe) (err error) {
+func (b *BPF) setWanted(pc uint64) (err error) {
+	return b.objs.ShouldTraceRip.Update(pc, true, ebpf.UpdateNoExist)
+}
+
+// TraceGoids adds the goroutines to trace, it takes effect immediately even
+// after attached, but only if the BPF programme is loaded with LoadOptions.Goids.
+func (b *BPF) TraceGoids(goids ...uint64) (err error) {
+	for _, goid := range goids {
+		if err = b.objs.GoidFilter.Update(goid, true, ebpf.UpdateAny); err != nil {
+			return errors.Wrapf(err, "trace goroutine %d", goid)
+		}
+	}
+	return
+}
+
+// UntraceGoids stops tracing the goroutines added by TraceGoids
+func (b *BPF) UntraceGoids(goids ...uint64) (err error) {
+	for _, goid := range goids {
+		if err = b.objs.GoidFilter.Delete(goid); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return errors.Wrapf(err, "untrace goroutine %d", goid)
+		}
+	}
+	return nil
+}
+
+// Attach attaches the uprobes to executable `bin`, if `pid` is not 0, only
+// the process `pid` will hit the uprobes.
+func (b *BPF) Attach(bin string, pid int, uprobes []uprobe.Uprobe) (err error) {
 	ex, err := link.OpenExecutable(bin)
 	if err != nil {
 		return
@@ -161,29 +241,42 @@ func (b *BPF) Attach(bin string, uprobes []uprobe.Uprobe) (err error) {
 		case uprobe.AtGoroutineExit:
 			prog = b.objs.GoroutineExit
 		}
-		fmt.Printf("attaching %d/%d\r", i+1, len(uprobes))
-		up, err := ex.Uprobe("", prog, &link.UprobeOptions{Offset: up.AbsOffset})
+		fmt.Fprintf(os.Stderr, "attaching %d/%d\r", i+1, len(uprobes))
+		up, err := ex.Uprobe("", prog, &link.UprobeOptions{Offset: up.AbsOffset, PID: pid})
 		if err != nil {
 			return err
 		}
-		b.closers = append(b.closers, up)
-
+		b.links = append(b.links, up)
 	}
+	fmt.Fprintln(os.Stderr)
 	return
 }
 
+// Detach detaches the uprobes if not yet, and closes the queues
 func (b *BPF) Detach() {
-	log.Info("start detaching\n")
-	sem := semaphore.NewWeighted(10)
-	for i, closer := range b.closers {
-		fmt.Printf("detaching %d/%d\r", i+1, len(b.closers))
-		sem.Acquire(context.Background(), 1)
-		go func(closer io.Closer) {
-			defer sem.Release(1)
-			closer.Close()
-		}(closer)
+	b.detachUprobes()
+	for _, closer := range b.closers {
+		closer.Close()
 	}
-	fmt.Println()
+}
+
+// detachUprobes detaches the uprobes once, no events are queued after it
+// returns, so the queues can be drained.
+func (b *BPF) detachUprobes() {
+	b.detachOnce.Do(func() {
+		log.Info("start detaching\n")
+		sem := semaphore.NewWeighted(10)
+		for i, link := range b.links {
+			fmt.Fprintf(os.Stderr, "detaching %d/%d\r", i+1, len(b.links))
+			sem.Acquire(context.Background(), 1)
+			go func(link io.Closer) {
+				defer sem.Release(1)
+				link.Close()
+			}(link)
+		}
+		sem.Acquire(context.Background(), 10)
+		fmt.Fprintln(os.Stderr)
+	})
 }
 
 func (b *BPF) PollEvents(ctx context.Context) chan GoftraceEvent {
@@ -195,6 +288,12 @@ func (b *BPF) PollEvents(ctx context.Context) chan GoftraceEvent {
 			event := GoftraceEvent{}
 			select {
 			case <-ctx.Done():
+				// drain the queued events, the uprobes are detached first,
+				// or a busy process keeps refilling the queue
+				b.detachUprobes()
+				for b.objs.EventQueue.LookupAndDelete(nil, &event) == nil {
+					ch <- event
+				}
 				return
 			default:
 				if err := b.objs.EventQueue.LookupAndDelete(nil, &event); err != nil {
@@ -216,6 +315,10 @@ func (b *BPF) PollArg(ctx context.Context) <-chan GoftraceArgData {
 			data := GoftraceArgData{}
 			select {
 			case <-ctx.Done():
+				b.detachUprobes()
+				for b.objs.ArgQueue.LookupAndDelete(nil, &data) == nil {
+					ch <- data
+				}
 				return
 			default:
 				if err := b.objs.ArgQueue.LookupAndDelete(nil, &data); err != nil {
@@ -0,0 +1,72 @@
+package bpf
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadGoftrace(t *testing.T) {
+	spec, err := LoadGoftrace()
+	require.Nil(t, err)
+	// every map and programme of the bindings must be in the embedded object,
+	// or it's not rebuilt by go generate after ftrace.c changed
+	require.Nil(t, spec.Assign(&GoftraceSpecs{}))
+}
+
+func Test_BpfConfig(t *testing.T) {
+	spec, err := LoadGoftrace()
+	require.Nil(t, err)
+	var config *btf.Struct
+	require.Nil(t, spec.Types.TypeByName("config", &config))
+
+	// CONFIG is rewritten by BpfConfig, its layout must match struct config
+	cfg := reflect.TypeOf(New().BpfConfig(false, false, 0, 0, 0))
+	require.Equal(t, uintptr(config.Size), cfg.Size())
+	require.Equal(t, len(config.Members), cfg.NumField())
+	for i, member := range config.Members {
+		require.Equal(t, uintptr(member.Offset/8), cfg.Field(i).Offset, member.Name)
+	}
+}
+
+// Test_LoadVerifier loads the programmes into the kernel, it needs root
+func Test_LoadVerifier(t *testing.T) {
+	spec, err := LoadGoftrace()
+	require.Nil(t, err)
+	b := New()
+	require.Nil(t, spec.RewriteConstants(map[string]interface{}{"CONFIG": b.BpfConfig(true, true, 152, -8, 0)}))
+
+	// CO-RE is relocated against the types of the object itself, ebpf v0.9
+	// can't read BTF of the newer kernels
+	b.objs = &GoftraceObjects{}
+	err = spec.LoadAndAssign(b.objs, &ebpf.CollectionOptions{
+		Programs: ebpf.ProgramOptions{KernelTypes: spec.Types, LogSize: verifierLogSize},
+	})
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, ebpf.ErrNotSupported) {
+		t.Skipf("can't load BPF programmes: %v", err)
+	}
+	require.Nil(t, err, "%+v", err)
+	defer b.objs.Close()
+
+	fetchArgs := []*uprobe.FetchArg{
+		{Varname: "s.name", Type: "c64", Size: 64, Rules: []*uprobe.ArgRule{
+			{From: uprobe.Register, Register: "ax"}, {From: uprobe.Stack, Offset: 0, Dereference: true}}},
+		{Varname: "s.name.len", Type: "s64", Size: 8, Rules: []*uprobe.ArgRule{
+			{From: uprobe.Register, Register: "ax"}, {From: uprobe.Stack, Offset: 8}}},
+		{Varname: "s.age", Type: "s64", Size: 8, Rules: []*uprobe.ArgRule{
+			{From: uprobe.Register, Register: "ax"}, {From: uprobe.Stack, Offset: 16}}},
+	}
+	predicates := []*uprobe.Predicate{
+		{Statement: `s.name == "bob"`, Arg: 0, Op: uprobe.OpEQ, Data: []byte("bob"), LenArg: 1},
+		{Statement: `s.name ^= "bo"`, Arg: 0, Op: uprobe.OpPrefix, Data: []byte("bo"), LenArg: -1},
+		{Statement: "s.age >= 18", Arg: 2, Op: uprobe.OpGE, Value: 18, LenArg: -1},
+	}
+	require.Nil(t, b.setArgRules(0x1000, fetchArgs))
+	require.Nil(t, b.setArgPredicates(0x1000, fetchArgs, predicates))
+}
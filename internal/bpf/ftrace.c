@@ -4,10 +4,28 @@
 #include "bpf_helpers.h"
 
 #define MAX_DATA_SIZE 64
+#define MAX_PREDICATES 4
 
 #define ENTPOINT 0
 #define RETPOINT 1
 
+// operators of struct arg_predicate
+#define OP_EQ 0
+#define OP_NE 1
+#define OP_LT 2
+#define OP_LE 3
+#define OP_GT 4
+#define OP_GE 5
+#define OP_PREFIX 6
+
+// types of struct arg_predicate
+#define PRED_UNSIGNED 0
+#define PRED_SIGNED 1
+#define PRED_BYTES 2
+
+// struct arg_predicate has no length arg
+#define NO_LEN_ARG 0xff
+
 // offset of `task_struct->thread_struct->fsbase`, `fsbase` contains the TLS
 // offset. On Linux register `FS` is used to load the TLS base address.
 #define fsbase_off (offsetof(struct task_struct, thread) + offsetof(struct thread_struct, fsbase))
@@ -19,12 +37,19 @@ char __license[] SEC("license") = "Dual MIT/GPL";
 // see: `fsbase_off` helps to read the TLS base address of the current task,
 // then we can get the runtime.g address by reading TLS+g_offset,
 // then we can get the runtime.go->goid by reading TLS+g_offset+goid_offset.
+//
+// `tgid` is the process id to trace, 0 means tracing all processes running
+// the same executable.
+//
+// `filter_goid` means only tracing the goroutines in `goid_filter`.
 struct config
 {
 	__s64 goid_offset;
 	__s64 g_offset;
+	__u32 tgid;
 	bool fetch_args;
-	__u8 padding[7];
+	bool filter_goid;
+	__u8 padding[2];
 };
 
 // add volatile to avoid compiler optimization (cache data in register),
@@ -77,6 +102,33 @@ struct arg_data
 
 const struct arg_data *___ __attribute__((unused));
 
+// a predicate on a fetched arg, like: req.id == 42, s.name == "bob"
+//
+// `arg` is the index of the arg in struct arg_rules, it's compared with
+// `value` if it's an integer of `size` bytes, or the first `size` bytes of
+// it are compared with `data`, and for == and != the length arg `len_arg`
+// must be `size` too.
+struct arg_predicate
+{
+	__u8 arg;
+	__u8 op;
+	__u8 type;
+	__u8 size;
+	__u8 len_arg;
+	__u8 padding[3];
+	__u64 value;
+	__u8 data[MAX_DATA_SIZE];
+};
+
+// a call starts a trace only if all predicates of the function are true
+struct arg_predicates
+{
+	__u8 length;
+	struct arg_predicate predicates[MAX_PREDICATES];
+};
+
+const struct arg_predicates *____ __attribute__((unused));
+
 struct bpf_map_def SEC("maps") arg_rules_map = {
 	.type = BPF_MAP_TYPE_HASH,
 	.key_size = sizeof(__u64),
@@ -84,6 +136,13 @@ struct bpf_map_def SEC("maps") arg_rules_map = {
 	.max_entries = 100,
 };
 
+struct bpf_map_def SEC("maps") arg_predicates_map = {
+	.type = BPF_MAP_TYPE_HASH,
+	.key_size = sizeof(__u64),
+	.value_size = sizeof(struct arg_predicates),
+	.max_entries = 100,
+};
+
 struct bpf_map_def SEC("maps") arg_queue = {
 	.type = BPF_MAP_TYPE_QUEUE,
 	.key_size = 0,
@@ -119,6 +178,14 @@ struct bpf_map_def SEC("maps") should_trace_goid = {
 	.max_entries = 10000,
 };
 
+// goroutines to trace if CONFIG.filter_goid, it's updated by userspace at runtime
+struct bpf_map_def SEC("maps") goid_filter = {
+	.type = BPF_MAP_TYPE_HASH,
+	.key_size = sizeof(__u64),
+	.value_size = sizeof(bool),
+	.max_entries = 1000,
+};
+
 struct bpf_map_def SEC("maps") should_trace_rip = {
 	.type = BPF_MAP_TYPE_HASH,
 	.key_size = sizeof(__u64),
@@ -126,6 +193,22 @@ struct bpf_map_def SEC("maps") should_trace_rip = {
 	.max_entries = 10000,
 };
 
+// check whether current task belongs to the process we want to trace
+static __always_inline bool is_target_process()
+{
+	if (!CONFIG.tgid)
+		return true;
+	return (bpf_get_current_pid_tgid() >> 32) == CONFIG.tgid;
+}
+
+// check whether goroutine `goid` is the one we want to trace
+static __always_inline bool is_target_goroutine(__u64 goid)
+{
+	if (!CONFIG.filter_goid)
+		return true;
+	return bpf_map_lookup_elem(&goid_filter, &goid) != NULL;
+}
+
 static __always_inline
 	__u64
 	get_goid()
@@ -202,7 +285,7 @@ static __always_inline void fetch_args_from_reg(struct pt_regs *ctx, struct arg_
 	return;
 }
 
-static __always_inline void fetch_args_from_memory(struct pt_regs *ctx, struct arg_data *data, struct arg_rule *rule)
+static __always_inline void read_arg_from_memory(struct pt_regs *ctx, struct arg_data *data, struct arg_rule *rule)
 {
 	// first read the address from register (well, it maybe a immediate value)
 	__u64 addr = 0;
@@ -228,6 +311,12 @@ static __always_inline void fetch_args_from_memory(struct pt_regs *ctx, struct a
 	bpf_probe_read_user(&data->data,
 						rule->size < MAX_DATA_SIZE ? rule->size : MAX_DATA_SIZE,
 						(void *)addr);
+	return;
+}
+
+static __always_inline void fetch_args_from_memory(struct pt_regs *ctx, struct arg_data *data, struct arg_rule *rule)
+{
+	read_arg_from_memory(ctx, data, rule);
 	// put the read data into the queue
 	bpf_map_push_elem(&arg_queue, data, BPF_EXIST);
 	return;
@@ -263,9 +352,103 @@ static __always_inline void fetch_args(struct pt_regs *ctx, __u64 goid, __u64 ip
 	}
 }
 
+// read the arg by `rule` into `data`, without queueing it
+static __always_inline void read_arg(struct pt_regs *ctx, struct arg_data *data, struct arg_rule *rule)
+{
+	__builtin_memset(data, 0, sizeof(*data));
+	switch (rule->type)
+	{
+	case 0:
+		read_reg(ctx, rule->reg, (__u64 *)&data->data);
+		break;
+	case 1:
+		read_arg_from_memory(ctx, data, rule);
+		break;
+	}
+}
+
+// compare the integer arg `a` with `b` by operator `op`
+#define COMPARE(op, a, b)            \
+	((op) == OP_EQ   ? (a) == (b)   \
+	 : (op) == OP_NE ? (a) != (b)   \
+	 : (op) == OP_LT ? (a) < (b)    \
+	 : (op) == OP_LE ? (a) <= (b)   \
+	 : (op) == OP_GT ? (a) > (b)    \
+	 : (op) == OP_GE ? (a) >= (b)   \
+					 : false)
+
+// check whether the arg `data` matches the predicate, `len` is the value of
+// the length arg if it has
+static __always_inline bool match_predicate(struct arg_predicate *pred, struct arg_data *data, __u64 len)
+{
+	if (pred->type == PRED_BYTES)
+	{
+		// ^= matches the prefix only
+		bool equal = pred->op == OP_PREFIX || len == pred->size;
+		for (int i = 0; equal && i < MAX_DATA_SIZE && i < pred->size; i++)
+		{
+			if (data->data[i] != pred->data[i])
+			{
+				equal = false;
+				break;
+			}
+		}
+		return pred->op == OP_NE ? !equal : equal;
+	}
+
+	// the integer is little-endian, truncate (or sign-extend) it to its size
+	__u64 value;
+	__builtin_memcpy(&value, data->data, sizeof(value));
+	int shift = (64 - pred->size * 8) & 63;
+	if (pred->type == PRED_SIGNED)
+	{
+		__s64 a = (__s64)(value << shift) >> shift;
+		__s64 b = (__s64)pred->value;
+		return COMPARE(pred->op, a, b);
+	}
+	value = (value << shift) >> shift;
+	return COMPARE(pred->op, value, pred->value);
+}
+
+// check whether the args of the call at `ip` match all predicates of the
+// function, true if the function has no predicates.
+static __always_inline bool match_predicates(struct pt_regs *ctx, __u64 ip)
+{
+	struct arg_predicates *preds = bpf_map_lookup_elem(&arg_predicates_map, &ip);
+	if (!preds)
+		return true;
+	struct arg_rules *rules = bpf_map_lookup_elem(&arg_rules_map, &ip);
+	if (!rules)
+		return false;
+
+	__u32 key = 0;
+	struct arg_data *data = bpf_map_lookup_elem(&arg_stack, &key);
+	if (!data)
+		return false;
+
+	for (int i = 0; i < MAX_PREDICATES && i < preds->length; i++)
+	{
+		struct arg_predicate *pred = &preds->predicates[i];
+
+		__u64 len = 0;
+		if (pred->len_arg != NO_LEN_ARG)
+		{
+			read_arg(ctx, data, &rules->rules[pred->len_arg & 7]);
+			__builtin_memcpy(&len, data->data, sizeof(len));
+		}
+		read_arg(ctx, data, &rules->rules[pred->arg & 7]);
+		if (!match_predicate(pred, data, len))
+			return false;
+	}
+	return true;
+}
+
 SEC("uprobe/ent")
 int ent(struct pt_regs *ctx)
 {
+	if (!is_target_process())
+		return 0;
+
 	__u32 key = 0;
 	struct event *e = bpf_map_lookup_elem(&event_stack, &key);
 	if (!e)
@@ -273,6 +456,9 @@ int ent(struct pt_regs *ctx)
 	__builtin_memset(e, 0, sizeof(*e));
 
 	e->goid = get_goid();
+	if (!is_target_goroutine(e->goid))
+		return 0;
+
 	e->ip = ctx->ip;
 	if (!bpf_map_lookup_elem(&should_trace_rip, &e->ip))
 	{
@@ -281,6 +467,10 @@ int ent(struct pt_regs *ctx)
 	}
 	else if (!bpf_map_lookup_elem(&should_trace_goid, &e->goid))
 	{
+		// only the calls with interesting args start a trace
+		if (!match_predicates(ctx, e->ip))
+			return 0;
+
 		__u64 should_trace = true;
 		bpf_map_update_elem(&should_trace_goid, &e->goid, &should_trace, BPF_ANY);
 	}
@@ -306,6 +496,9 @@ cont:
 SEC("uprobe/ret")
 int ret(struct pt_regs *ctx)
 {
+	if (!is_target_process())
+		return 0;
+
 	__u32 key = 0;
 	struct event *e = bpf_map_lookup_elem(&event_stack, &key);
 	if (!e)
@@ -326,6 +519,9 @@ int ret(struct pt_regs *ctx)
 SEC("uprobe/goroutine_exit")
 int goroutine_exit(struct pt_regs *ctx)
 {
+	if (!is_target_process())
+		return 0;
+
 	__u64 goid = get_goid();
 	bpf_map_delete_elem(&should_trace_goid, &goid);
 	return 0;
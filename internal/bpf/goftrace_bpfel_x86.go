@@ -18,6 +18,23 @@ type GoftraceArgData struct {
 	Data [64]uint8
 }
 
+type GoftraceArgPredicate struct {
+	Arg     uint8
+	Op      uint8
+	Type    uint8
+	Size    uint8
+	LenArg  uint8
+	Padding [3]uint8
+	Value   uint64
+	Data    [64]uint8
+}
+
+type GoftraceArgPredicates struct {
+	Length     uint8
+	_          [7]byte
+	Predicates [4]GoftraceArgPredicate
+}
+
 type GoftraceArgRule struct {
 	Type        uint8
 	Reg         uint8
@@ -94,13 +111,15 @@ type GoftraceProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type GoftraceMapSpecs struct {
-	ArgQueue        *ebpf.MapSpec `ebpf:"arg_queue"`
-	ArgRulesMap     *ebpf.MapSpec `ebpf:"arg_rules_map"`
-	ArgStack        *ebpf.MapSpec `ebpf:"arg_stack"`
-	EventQueue      *ebpf.MapSpec `ebpf:"event_queue"`
-	EventStack      *ebpf.MapSpec `ebpf:"event_stack"`
-	ShouldTraceGoid *ebpf.MapSpec `ebpf:"should_trace_goid"`
-	ShouldTraceRip  *ebpf.MapSpec `ebpf:"should_trace_rip"`
+	ArgPredicatesMap *ebpf.MapSpec `ebpf:"arg_predicates_map"`
+	ArgQueue         *ebpf.MapSpec `ebpf:"arg_queue"`
+	ArgRulesMap      *ebpf.MapSpec `ebpf:"arg_rules_map"`
+	ArgStack         *ebpf.MapSpec `ebpf:"arg_stack"`
+	EventQueue       *ebpf.MapSpec `ebpf:"event_queue"`
+	EventStack       *ebpf.MapSpec `ebpf:"event_stack"`
+	GoidFilter       *ebpf.MapSpec `ebpf:"goid_filter"`
+	ShouldTraceGoid  *ebpf.MapSpec `ebpf:"should_trace_goid"`
+	ShouldTraceRip   *ebpf.MapSpec `ebpf:"should_trace_rip"`
 }
 
 // GoftraceObjects contains all objects after they have been loaded into the kernel.
@@ -122,22 +141,26 @@ func (o *GoftraceObjects) Close() error {
 //
 // It can be passed to LoadGoftraceObjects or ebpf.CollectionSpec.LoadAndAssign.
 type GoftraceMaps struct {
-	ArgQueue        *ebpf.Map `ebpf:"arg_queue"`
-	ArgRulesMap     *ebpf.Map `ebpf:"arg_rules_map"`
-	ArgStack        *ebpf.Map `ebpf:"arg_stack"`
-	EventQueue      *ebpf.Map `ebpf:"event_queue"`
-	EventStack      *ebpf.Map `ebpf:"event_stack"`
-	ShouldTraceGoid *ebpf.Map `ebpf:"should_trace_goid"`
-	ShouldTraceRip  *ebpf.Map `ebpf:"should_trace_rip"`
+	ArgPredicatesMap *ebpf.Map `ebpf:"arg_predicates_map"`
+	ArgQueue         *ebpf.Map `ebpf:"arg_queue"`
+	ArgRulesMap      *ebpf.Map `ebpf:"arg_rules_map"`
+	ArgStack         *ebpf.Map `ebpf:"arg_stack"`
+	EventQueue       *ebpf.Map `ebpf:"event_queue"`
+	EventStack       *ebpf.Map `ebpf:"event_stack"`
+	GoidFilter       *ebpf.Map `ebpf:"goid_filter"`
+	ShouldTraceGoid  *ebpf.Map `ebpf:"should_trace_goid"`
+	ShouldTraceRip   *ebpf.Map `ebpf:"should_trace_rip"`
 }
 
 func (m *GoftraceMaps) Close() error {
 	return _GoftraceClose(
+		m.ArgPredicatesMap,
 		m.ArgQueue,
 		m.ArgRulesMap,
 		m.ArgStack,
 		m.EventQueue,
 		m.EventStack,
+		m.GoidFilter,
 		m.ShouldTraceGoid,
 		m.ShouldTraceRip,
 	)
@@ -0,0 +1,139 @@
+package eventmanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Arg is a fetched argument of a function call
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// Call is a traced function call, built from its entry and return events
+type Call struct {
+	Goid     uint64
+	Function string
+	Args     []Arg
+	Caller   string    // symbol+offset of the caller, where the function is called
+	CallSite string    // file:line of the call site
+	Start    time.Time // wall time of the entry event
+	StartNs  uint64    // bpf_ktime_get_ns of the entry event
+
+	Returned  bool      // false if the function hasn't returned when tracing stops
+	RetFunc   string    // symbol of the RET instruction
+	RetOffset uint      // offset of the RET instruction to the symbol
+	RetSite   string    // file:line of the RET instruction
+	End       time.Time // wall time of the return event
+	EndNs     uint64    // bpf_ktime_get_ns of the return event
+
+	Parent   *Call
+	Children []*Call
+}
+
+// Duration returns the wall time of the call, 0 if it hasn't returned
+func (c *Call) Duration() time.Duration {
+	if !c.Returned {
+		return 0
+	}
+	return time.Duration(c.EndNs - c.StartNs)
+}
+
+// SelfTime returns the wall time of the call excluding its returned children,
+// 0 if it hasn't returned
+func (c *Call) SelfTime() time.Duration {
+	self := c.Duration()
+	for _, child := range c.Children {
+		self -= child.Duration()
+	}
+	if self < 0 {
+		return 0
+	}
+	return self
+}
+
+// ArgString returns the args like: a=1, b=2
+func (c *Call) ArgString() string {
+	args := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		args = append(args, arg.Name+"="+arg.Value)
+	}
+	return strings.Join(args, ", ")
+}
+
+// Walk walks the call tree in depth-first order, `enter` is called before
+// the children are walked, and `leave` after that, `depth` of root is 0.
+func (c *Call) Walk(enter, leave func(call *Call, depth int) error) error {
+	return c.walk(0, enter, leave)
+}
+
+func (c *Call) walk(depth int, enter, leave func(call *Call, depth int) error) error {
+	if enter != nil {
+		if err := enter(c, depth); err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Children {
+		if err := child.walk(depth+1, enter, leave); err != nil {
+			return err
+		}
+	}
+	if leave != nil {
+		return leave(c, depth)
+	}
+	return nil
+}
+
+// BuildCalls builds the call trees from the events of goroutine `goid`
+func (m *EventManager) BuildCalls(goid uint64) (roots []*Call, err error) {
+	var stack []*Call
+	for _, event := range m.goEvents[goid] {
+		switch event.Location {
+		case 0: // entpoint
+			call := &Call{
+				Goid:     goid,
+				Function: event.uprobe.Funcname,
+				Args:     event.args,
+				CallSite: "?:?",
+				Start:    m.bootTime.Add(time.Duration(event.TimeNs)),
+				StartNs:  event.TimeNs,
+			}
+			if call.Caller, err = m.SprintCallChain(event); err != nil {
+				return
+			}
+			if filename, line, err := m.elf.LineInfoForPc(event.CallerIp); err == nil {
+				call.CallSite = fmt.Sprintf("%s:%d", filename, line)
+			}
+			if len(stack) > 0 {
+				call.Parent = stack[len(stack)-1]
+				call.Parent.Children = append(call.Parent.Children, call)
+			} else {
+				roots = append(roots, call)
+			}
+			stack = append(stack, call)
+
+		case 1: // retpoint
+			if len(stack) == 0 {
+				continue
+			}
+			syms, offset, err := m.elf.ResolveAddress(event.Ip)
+			if err != nil {
+				return nil, err
+			}
+			call := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			call.Returned = true
+			call.RetFunc = syms[0].Name
+			call.RetOffset = offset
+			call.RetSite = "?:?"
+			call.End = m.bootTime.Add(time.Duration(event.TimeNs))
+			call.EndNs = event.TimeNs
+			if filename, line, err := m.elf.LineInfoForPc(event.Ip); err == nil {
+				call.RetSite = fmt.Sprintf("%s:%d", filename, line)
+			}
+		}
+	}
+	return
+}
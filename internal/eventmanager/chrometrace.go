@@ -0,0 +1,103 @@
+package eventmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// chromeTraceOutput writes the call trees in Chrome Trace Event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+//
+// Each goroutine is a thread track, returned calls are complete events ("X"),
+// and calls not returned are begin events ("B") lasting to the end of trace.
+type chromeTraceOutput struct {
+	w       io.Writer
+	started bool
+	goids   map[uint64]bool // goroutines whose thread_name is written
+}
+
+func newChromeTraceOutput(w io.Writer) *chromeTraceOutput {
+	return &chromeTraceOutput{w: w, goids: map[uint64]bool{}}
+}
+
+// chromeTraceEvent is the JSON object of a trace event
+type chromeTraceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat,omitempty"`
+	Ph   string            `json:"ph"`
+	Ts   float64           `json:"ts"` // in microseconds
+	Dur  *float64          `json:"dur,omitempty"`
+	Pid  int               `json:"pid"`
+	Tid  uint64            `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+func (o *chromeTraceOutput) Write(root *Call) error {
+	if !o.goids[root.Goid] {
+		o.goids[root.Goid] = true
+		err := o.writeEvent(&chromeTraceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  root.Goid,
+			Args: map[string]string{"name": fmt.Sprintf("goroutine %d", root.Goid)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return root.Walk(func(call *Call, depth int) error {
+		event := &chromeTraceEvent{
+			Name: call.Function,
+			Cat:  "function",
+			Ph:   "B",
+			Ts:   float64(call.StartNs) / 1e3,
+			Pid:  1,
+			Tid:  call.Goid,
+			Args: chromeTraceArgs(call.Args),
+		}
+		if call.Returned {
+			dur := float64(call.Duration()) / 1e3
+			event.Ph, event.Dur = "X", &dur
+		}
+		return o.writeEvent(event)
+	}, nil)
+}
+
+// chromeTraceArgs returns the args of a trace event, it's an object by the format
+func chromeTraceArgs(args []Arg) map[string]string {
+	if len(args) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(args))
+	for _, arg := range args {
+		m[arg.Name] = arg.Value
+	}
+	return m
+}
+
+func (o *chromeTraceOutput) writeEvent(event *chromeTraceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if !o.started {
+		o.started, sep = true, "{\"traceEvents\":[\n"
+	}
+	if _, err = io.WriteString(o.w, sep); err != nil {
+		return err
+	}
+	_, err = o.w.Write(data)
+	return err
+}
+
+func (o *chromeTraceOutput) Close() error {
+	if !o.started {
+		_, err := io.WriteString(o.w, "{\"traceEvents\":[]}\n")
+		return err
+	}
+	_, err := io.WriteString(o.w, "\n],\"displayTimeUnit\":\"ns\"}\n")
+	return err
+}
@@ -0,0 +1,43 @@
+package eventmanager
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// calibrateTries is the number of tries to read the clocks, the closest
+// readings are used
+const calibrateTries = 10
+
+// MonotonicEpoch returns the wall time when CLOCK_MONOTONIC is 0, the event
+// timestamps by bpf_ktime_get_ns are converted to wall time by adding it.
+//
+// It's not the boot time, CLOCK_MONOTONIC doesn't count the time suspended.
+// It's calibrated by reading CLOCK_REALTIME between 2 CLOCK_MONOTONIC, so
+// the error is at most half of the interval between them, less than 1µs.
+func MonotonicEpoch() (time.Time, error) {
+	var (
+		best   int64 = -1
+		offset int64
+	)
+	for i := 0; i < calibrateTries; i++ {
+		var mono1, real, mono2 unix.Timespec
+		if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &mono1); err != nil {
+			return time.Time{}, errors.WithStack(err)
+		}
+		if err := unix.ClockGettime(unix.CLOCK_REALTIME, &real); err != nil {
+			return time.Time{}, errors.WithStack(err)
+		}
+		if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &mono2); err != nil {
+			return time.Time{}, errors.WithStack(err)
+		}
+		interval := mono2.Nano() - mono1.Nano()
+		if best < 0 || interval < best {
+			best = interval
+			offset = real.Nano() - (mono1.Nano() + interval/2)
+		}
+	}
+	return time.Unix(0, offset), nil
+}
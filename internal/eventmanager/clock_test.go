@@ -0,0 +1,19 @@
+package eventmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_MonotonicEpoch(t *testing.T) {
+	epoch, err := MonotonicEpoch()
+	require.Nil(t, err)
+
+	var mono unix.Timespec
+	require.Nil(t, unix.ClockGettime(unix.CLOCK_MONOTONIC, &mono))
+	now := time.Now()
+	require.WithinDuration(t, now, epoch.Add(time.Duration(mono.Nano())), time.Millisecond)
+}
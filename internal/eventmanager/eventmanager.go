@@ -1,12 +1,12 @@
 package eventmanager
 
 import (
+	debugelf "debug/elf"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
-	"github.com/elastic/go-sysinfo"
-	"github.com/hitzhangjie/go-ftrace/elf"
 	"github.com/hitzhangjie/go-ftrace/internal/bpf"
 	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
 	log "github.com/sirupsen/logrus"
@@ -15,44 +15,83 @@ import (
 // Event represents a func enter/ret event, see ftrace.c event
 type Event struct {
 	bpf.GoftraceEvent
-	uprobe    *uprobe.Uprobe
-	argString string
+	uprobe *uprobe.Uprobe
+	args   []Arg
+}
+
+// Symbolizer resolves the link-time addresses in the events, it's the traced
+// elf.ELF, or the snapshot of it in a trace file when replaying.
+type Symbolizer interface {
+	ResolveAddress(addr uint64) (syms []debugelf.Symbol, offset uint, err error)
+	LineInfoForPc(pc uint64) (filename string, line int, err error)
 }
 
 // EventManager manages events
 type EventManager struct {
-	elf       *elf.ELF
-	argCh     <-chan bpf.GoftraceArgData
-	uprobes   map[string]uprobe.Uprobe
-	drilldown string
+	elf         Symbolizer
+	argCh       <-chan bpf.GoftraceArgData
+	uprobes     map[string]uprobe.Uprobe
+	drilldown   []string
+	minDuration time.Duration
 
 	goEvents     map[uint64][]Event // k=goid,v=[]event
 	goEventStack map[uint64]uint64
 	goArgs       map[uint64]chan bpf.GoftraceArgData
 
 	bootTime time.Time
+	roots    int    // number of completed root calls printed
+	loadBias uint64 // load bias of PIE executable, runtime address = link-time address + loadBias
+	output   Output
+}
+
+// Options options to create an EventManager
+type Options struct {
+	// Drilldown only outputs the callstacks of the functions matching these
+	// wildcards, each matching call is output as a root call with its
+	// children, and the calls not in them are dropped.
+	Drilldown []string
+	// MinDuration only outputs the callstacks whose root call (the drilldown
+	// call if specified) took at least the duration, 0 means no limit.
+	MinDuration time.Duration
+	// LoadBias is the load bias of PIE executable, addresses in the events are
+	// converted to link-time addresses before resolving symbols and line info.
+	LoadBias uint64
+	// Output outputs the callstacks, default is colored text to stdout
+	Output Output
+	// BootTime is the wall time when CLOCK_MONOTONIC is 0 on the host where
+	// the events are traced, the timestamps in the events are relative to
+	// it, default is MonotonicEpoch of this host.
+	BootTime time.Time
 }
 
 // New create a new EventManager, which receives events via `ch`
-func New(uprobes []uprobe.Uprobe, drilldown string, elf *elf.ELF, ch <-chan bpf.GoftraceArgData) (_ *EventManager, err error) {
-	host, err := sysinfo.Host()
-	if err != nil {
-		return
+func New(uprobes []uprobe.Uprobe, elf Symbolizer, ch <-chan bpf.GoftraceArgData, opts Options) (_ *EventManager, err error) {
+	bootTime := opts.BootTime
+	if bootTime.IsZero() {
+		if bootTime, err = MonotonicEpoch(); err != nil {
+			return
+		}
 	}
-	bootTime := host.Info().BootTime
 	uprobesMap := map[string]uprobe.Uprobe{}
 	for _, up := range uprobes {
 		uprobesMap[fmt.Sprintf("%s+%d", up.Funcname, up.RelOffset)] = up
 	}
+	output := opts.Output
+	if output == nil {
+		output = &textOutput{w: os.Stdout}
+	}
 	m := &EventManager{
 		elf:          elf,
 		argCh:        ch,
 		uprobes:      uprobesMap,
-		drilldown:    drilldown,
+		drilldown:    opts.Drilldown,
+		minDuration:  opts.MinDuration,
 		goEvents:     map[uint64][]Event{},
 		goEventStack: map[uint64]uint64{},
 		goArgs:       map[uint64]chan bpf.GoftraceArgData{},
 		bootTime:     bootTime,
+		loadBias:     opts.LoadBias,
+		output:       output,
 	}
 	go m.handleArg()
 	return m, err
@@ -69,6 +108,11 @@ func (m *EventManager) handleArg() {
 	}
 }
 
+// Roots returns the number of completed root calls printed
+func (m *EventManager) Roots() int {
+	return m.roots
+}
+
 // GetUprobe returns the uprobe of the given event
 func (m *EventManager) GetUprobe(event bpf.GoftraceEvent) (_ uprobe.Uprobe, err error) {
 	syms, offset, err := m.elf.ResolveAddress(event.Ip)
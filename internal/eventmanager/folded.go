@@ -0,0 +1,53 @@
+package eventmanager
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// foldedOutput writes the call trees as folded stacks, like:
+//
+//	main.doSomething;main.add;main.add1 1200
+//
+// weighted by the self time in nanoseconds, which is rendered by flamegraph.pl
+// or speedscope. The stacks are aggregated and written when it's closed.
+type foldedOutput struct {
+	w      io.Writer
+	stacks map[string]int64
+}
+
+func newFoldedOutput(w io.Writer) *foldedOutput {
+	return &foldedOutput{w: w, stacks: map[string]int64{}}
+}
+
+func (o *foldedOutput) Write(root *Call) error {
+	var frames []string
+	return root.Walk(func(call *Call, depth int) error {
+		// `;` separates the frames, it's found in the shapes of generic functions like
+		// main.F[go.shape.struct { a int; b int }]
+		frames = append(frames, strings.ReplaceAll(call.Function, ";", ","))
+		if self := call.SelfTime(); self > 0 {
+			o.stacks[strings.Join(frames, ";")] += int64(self)
+		}
+		return nil
+	}, func(call *Call, depth int) error {
+		frames = frames[:len(frames)-1]
+		return nil
+	})
+}
+
+func (o *foldedOutput) Close() error {
+	stacks := make([]string, 0, len(o.stacks))
+	for stack := range o.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(o.w, "%s %d\n", stack, o.stacks[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,43 +1,83 @@
 package eventmanager
 
 import (
-	"strings"
 	"time"
 
 	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
 	log "github.com/sirupsen/logrus"
 )
 
 // Handle handles the event
 func (m *EventManager) Handle(event bpf.GoftraceEvent) error {
+	event = m.linkTimeEvent(event)
 	m.Add(event)
 	log.Debugf("added event: %+v", event)
 	if m.CloseStack(event) {
 		// 有错没错都要清空栈
 		defer m.ClearStack(event)
 
-		var needPrint bool
-
-		// drilldown特定函数
-		if m.drilldown == "" {
-			needPrint = true
-		} else {
-			syms, _, err := m.elf.ResolveAddress(event.Ip)
-			if err != nil {
-				return err
-			}
-			fnName := syms[0].Name
-			needPrint = (fnName == m.drilldown)
+		// drilldown特定函数, 没有匹配的调用就不必构建调用树了
+		if len(m.drilldown) > 0 && !m.hasDrilldown(event.Goid) {
+			return nil
 		}
 
-		if !needPrint {
-			return nil
+		// 只输出耗时超过阈值的调用栈
+		if len(m.drilldown) == 0 && m.minDuration > 0 {
+			start := m.goEvents[event.Goid][0].TimeNs
+			if time.Duration(event.TimeNs-start) < m.minDuration {
+				return nil
+			}
 		}
 		return m.PrintStack(event.Goid)
 	}
 	return nil
 }
 
+// hasDrilldown reports whether goroutine `goid` called any drilldown function
+func (m *EventManager) hasDrilldown(goid uint64) bool {
+	for _, event := range m.goEvents[goid] {
+		if event.Location == 0 && m.isDrilldown(event.uprobe.Funcname) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDrilldown reports whether function `funcname` matches any drilldown wildcard
+func (m *EventManager) isDrilldown(funcname string) bool {
+	for _, wildcard := range m.drilldown {
+		if uprobe.MatchWildcard(wildcard, funcname) {
+			return true
+		}
+	}
+	return false
+}
+
+// drilldownCalls returns the outermost calls of the drilldown functions in
+// the call trees `roots`, they're detached from their callers as new roots.
+func (m *EventManager) drilldownCalls(roots []*Call) []*Call {
+	if len(m.drilldown) == 0 {
+		return roots
+	}
+	var calls []*Call
+	var find func(call *Call)
+	find = func(call *Call) {
+		if m.isDrilldown(call.Function) {
+			call.Parent = nil
+			calls = append(calls, call)
+			return
+		}
+		for _, child := range call.Children {
+			find(child)
+		}
+	}
+	for _, root := range roots {
+		find(root)
+	}
+	return calls
+}
+
 func (m *EventManager) Add(event bpf.GoftraceEvent) {
 	length := len(m.goEvents[event.Goid])
 	if length == 0 && event.Location != 0 {
@@ -65,23 +105,20 @@ func (m *EventManager) Add(event bpf.GoftraceEvent) {
 		}
 	}
 	// we need to fetch `len(uprobe.FetchArgs)` args
-	args := []string{}
+	args := []Arg{}
 	for _, fetchArg := range uprobe.FetchArgs {
 		for m.goArgs[event.Goid] == nil {
 			time.Sleep(time.Millisecond)
 		}
 		arg := <-m.goArgs[event.Goid]
-		if len(args) > 0 {
-			args = append(args, ", ")
-		}
 		// varname = value
-		args = append(args, fetchArg.Varname, "=", fetchArg.SprintValue(arg.Data[:]))
+		args = append(args, Arg{Name: fetchArg.Varname, Value: fetchArg.SprintValue(arg.Data[:])})
 	}
 	// append new event
 	m.goEvents[event.Goid] = append(m.goEvents[event.Goid], Event{
 		GoftraceEvent: event,
 		uprobe:        &uprobe,
-		argString:     strings.Join(args, ""),
+		args:          args,
 	})
 	switch event.Location {
 	case 0: // entry
@@ -104,3 +141,16 @@ func (m *EventManager) ClearStack(event bpf.GoftraceEvent) {
 	delete(m.goEvents, event.Goid)
 	delete(m.goEventStack, event.Goid)
 }
+
+// linkTimeEvent converts the runtime addresses in event to link-time addresses,
+// so they can be resolved by .symtab and DWARF of the PIE executable.
+func (m *EventManager) linkTimeEvent(event bpf.GoftraceEvent) bpf.GoftraceEvent {
+	if m.loadBias == 0 {
+		return event
+	}
+	event.Ip -= m.loadBias
+	if event.CallerIp != 0 {
+		event.CallerIp -= m.loadBias
+	}
+	return event
+}
@@ -0,0 +1,110 @@
+package eventmanager
+
+import (
+	debugelf "debug/elf"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
+	"github.com/stretchr/testify/require"
+)
+
+// testSymbolizer resolves the addresses of the functions in testFuncs, each
+// function occupies 0x100 bytes.
+type testSymbolizer map[uint64]string // k=function entry
+
+func (s testSymbolizer) ResolveAddress(addr uint64) ([]debugelf.Symbol, uint, error) {
+	entry := addr &^ 0xff
+	name, ok := s[entry]
+	if !ok {
+		return nil, 0, errors.New("symbol not found")
+	}
+	return []debugelf.Symbol{{Name: name, Value: entry}}, uint(addr - entry), nil
+}
+
+func (s testSymbolizer) LineInfoForPc(pc uint64) (string, int, error) {
+	return "main.go", int(pc & 0xff), nil
+}
+
+// collectOutput collects the call trees written
+type collectOutput []*Call
+
+func (o *collectOutput) Write(root *Call) error {
+	*o = append(*o, root)
+	return nil
+}
+
+func (o *collectOutput) Close() error {
+	return nil
+}
+
+// testFuncs are the traced functions, entry and ret uprobes at +0 and +0x80
+var testFuncs = testSymbolizer{0x1000: "main.main", 0x2000: "main.doSomething", 0x3000: "main.add", 0x4000: "main.minus"}
+
+func newTestEventManager(t *testing.T, opts Options) (*EventManager, *collectOutput) {
+	uprobes := []uprobe.Uprobe{}
+	for entry, name := range testFuncs {
+		uprobes = append(uprobes,
+			uprobe.Uprobe{Funcname: name, Address: entry, Location: uprobe.AtEntry},
+			uprobe.Uprobe{Funcname: name, Address: entry + 0x80, RelOffset: 0x80, Location: uprobe.AtRet})
+	}
+	output := &collectOutput{}
+	opts.Output, opts.BootTime = output, time.Unix(0, 0)
+	m, err := New(uprobes, testFuncs, make(chan bpf.GoftraceArgData), opts)
+	require.Nil(t, err)
+	return m, output
+}
+
+// testEvents returns the events of calls on goroutine 1 at `ns`, like:
+// "main.doSomething", "main.add", "/", "/" enters 2 functions and returns
+func testEvents(ns uint64, calls ...string) (events []bpf.GoftraceEvent) {
+	var stack []uint64
+	for _, call := range calls {
+		ns += uint64(time.Millisecond)
+		if call == "/" {
+			entry := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			events = append(events, bpf.GoftraceEvent{Goid: 1, Ip: entry + 0x80, TimeNs: ns, Location: 1})
+			continue
+		}
+		for entry, name := range testFuncs {
+			if name == call {
+				events = append(events, bpf.GoftraceEvent{Goid: 1, Ip: entry, CallerIp: 0x1010, TimeNs: ns})
+				stack = append(stack, entry)
+			}
+		}
+	}
+	return
+}
+
+func Test_HandleMinDuration(t *testing.T) {
+	m, output := newTestEventManager(t, Options{MinDuration: 3 * time.Millisecond})
+	events := testEvents(0, "main.doSomething", "/")                                       // 1ms
+	events = append(events, testEvents(10e6, "main.doSomething", "main.add", "/", "/")...) // 3ms
+	for _, event := range events {
+		require.Nil(t, m.Handle(event))
+	}
+	require.Len(t, *output, 1)
+	require.Equal(t, 1, m.Roots())
+	require.Equal(t, 3*time.Millisecond, (*output)[0].Duration())
+	require.Len(t, (*output)[0].Children, 1)
+}
+
+func Test_HandleDrilldown(t *testing.T) {
+	m, output := newTestEventManager(t, Options{Drilldown: []string{"main.a*", "main.minus"}, MinDuration: 2 * time.Millisecond})
+	// main.add is re-rooted, main.minus is dropped by min duration, main.doSomething in between is dropped
+	events := testEvents(0, "main.main", "main.doSomething", "main.add", "main.minus", "/", "/", "/", "main.minus", "/", "/")
+	events = append(events, testEvents(20e6, "main.doSomething", "/")...)
+	for _, event := range events {
+		require.Nil(t, m.Handle(event))
+	}
+	require.Len(t, *output, 1)
+	require.Equal(t, 1, m.Roots())
+	root := (*output)[0]
+	require.Equal(t, "main.add", root.Function)
+	require.Nil(t, root.Parent)
+	require.Len(t, root.Children, 1)
+	require.Equal(t, "main.minus", root.Children[0].Function)
+}
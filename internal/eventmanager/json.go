@@ -0,0 +1,126 @@
+package eventmanager
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonOutput writes JSON Lines, one object per entry/return event, or one
+// object per root call tree if `tree` is true.
+type jsonOutput struct {
+	enc  *json.Encoder
+	tree bool
+}
+
+func newJSONOutput(w io.Writer, tree bool) *jsonOutput {
+	return &jsonOutput{enc: json.NewEncoder(w), tree: tree}
+}
+
+// jsonEvent is the JSON object of an entry/return event
+type jsonEvent struct {
+	Goid       uint64    `json:"goid"`
+	Event      string    `json:"event"` // entry, return
+	Depth      int       `json:"depth"`
+	Function   string    `json:"function"`
+	Args       []jsonArg `json:"args,omitempty"`
+	Caller     string    `json:"caller,omitempty"`
+	File       string    `json:"file"` // file:line of the call site or RET instruction
+	Time       time.Time `json:"time"`
+	TimeNs     uint64    `json:"time_ns"`
+	DurationNs int64     `json:"duration_ns,omitempty"`
+}
+
+// jsonCall is the JSON object of a call tree
+type jsonCall struct {
+	Goid       uint64      `json:"goid"`
+	Function   string      `json:"function"`
+	Args       []jsonArg   `json:"args,omitempty"`
+	Caller     string      `json:"caller,omitempty"`
+	CallSite   string      `json:"call_site"`
+	RetSite    string      `json:"ret_site,omitempty"`
+	Start      time.Time   `json:"start"`
+	StartNs    uint64      `json:"start_ns"`
+	End        *time.Time  `json:"end,omitempty"`
+	EndNs      uint64      `json:"end_ns,omitempty"`
+	DurationNs int64       `json:"duration_ns"`
+	Returned   bool        `json:"returned"`
+	Children   []*jsonCall `json:"children,omitempty"`
+}
+
+func (o *jsonOutput) Write(root *Call) error {
+	if o.tree {
+		return o.enc.Encode(newJSONCall(root))
+	}
+	return root.Walk(func(call *Call, depth int) error {
+		return o.enc.Encode(&jsonEvent{
+			Goid:     call.Goid,
+			Event:    "entry",
+			Depth:    depth,
+			Function: call.Function,
+			Args:     jsonArgs(call.Args),
+			Caller:   call.Caller,
+			File:     call.CallSite,
+			Time:     call.Start,
+			TimeNs:   call.StartNs,
+		})
+	}, func(call *Call, depth int) error {
+		if !call.Returned {
+			return nil
+		}
+		return o.enc.Encode(&jsonEvent{
+			Goid:       call.Goid,
+			Event:      "return",
+			Depth:      depth,
+			Function:   call.Function,
+			File:       call.RetSite,
+			Time:       call.End,
+			TimeNs:     call.EndNs,
+			DurationNs: int64(call.Duration()),
+		})
+	})
+}
+
+func (o *jsonOutput) Close() error {
+	return nil
+}
+
+func newJSONCall(call *Call) *jsonCall {
+	c := &jsonCall{
+		Goid:       call.Goid,
+		Function:   call.Function,
+		Args:       jsonArgs(call.Args),
+		Caller:     call.Caller,
+		CallSite:   call.CallSite,
+		Start:      call.Start,
+		StartNs:    call.StartNs,
+		DurationNs: int64(call.Duration()),
+		Returned:   call.Returned,
+	}
+	if call.Returned {
+		end := call.End
+		c.RetSite, c.End, c.EndNs = call.RetSite, &end, call.EndNs
+	}
+	for _, child := range call.Children {
+		c.Children = append(c.Children, newJSONCall(child))
+	}
+	return c
+}
+
+// jsonArg is the JSON object of a fetched arg, args are listed in the order
+// of the fetch spec
+type jsonArg struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func jsonArgs(args []Arg) []jsonArg {
+	if len(args) == 0 {
+		return nil
+	}
+	list := make([]jsonArg, 0, len(args))
+	for _, arg := range args {
+		list = append(list, jsonArg{Name: arg.Name, Value: arg.Value})
+	}
+	return list
+}
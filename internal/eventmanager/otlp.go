@@ -0,0 +1,126 @@
+package eventmanager
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otlpShutdownTimeout is the timeout of flushing the buffered spans when
+// the output is closed
+const otlpShutdownTimeout = 10 * time.Second
+
+// otlpOutput exports each call as an OpenTelemetry span via OTLP, the
+// children calls are the child spans.
+type otlpOutput struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// newOTLPOutput creates the otlpOutput exporting to `endpoint`:
+//
+//   - http://localhost:4318, https://collector:4318/v1/traces: OTLP/HTTP
+//   - grpc://localhost:4317, grpcs://collector:4317: OTLP/gRPC
+//   - empty: OTLP/HTTP, configured by OTEL_EXPORTER_OTLP_* environment variables
+//
+// The service name is ftrace by default, and can be changed by OTEL_SERVICE_NAME.
+func newOTLPOutput(endpoint string) (_ *otlpOutput, err error) {
+	client, err := newOTLPClient(endpoint)
+	if err != nil {
+		return
+	}
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName("ftrace")),
+		resource.WithFromEnv())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res))
+	return &otlpOutput{
+		provider: provider,
+		tracer:   provider.Tracer("github.com/hitzhangjie/go-ftrace"),
+	}, nil
+}
+
+func newOTLPClient(endpoint string) (otlptrace.Client, error) {
+	if endpoint == "" {
+		return otlptracehttp.NewClient(), nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("invalid otlp endpoint %s, want scheme://host:port", endpoint)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.NewClient(opts...), nil
+	case "grpc", "grpcs":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+		if u.Scheme == "grpc" {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.NewClient(opts...), nil
+	default:
+		return nil, errors.Errorf("invalid otlp endpoint %s, unknown scheme %s", endpoint, u.Scheme)
+	}
+}
+
+func (o *otlpOutput) Write(root *Call) error {
+	ctxs := []context.Context{context.Background()}
+	return root.Walk(func(call *Call, depth int) error {
+		attrs := []attribute.KeyValue{
+			attribute.Int64("goroutine.id", int64(call.Goid)),
+			attribute.String("ftrace.caller", call.Caller),
+			attribute.String("ftrace.call_site", call.CallSite),
+			attribute.Bool("ftrace.returned", call.Returned),
+		}
+		for _, arg := range call.Args {
+			attrs = append(attrs, attribute.String("ftrace.arg."+arg.Name, arg.Value))
+		}
+		if call.Returned {
+			attrs = append(attrs, attribute.String("ftrace.ret_site", call.RetSite))
+		}
+		ctx, _ := o.tracer.Start(ctxs[len(ctxs)-1], call.Function,
+			trace.WithTimestamp(call.Start),
+			trace.WithAttributes(attrs...))
+		ctxs = append(ctxs, ctx)
+		return nil
+	}, func(call *Call, depth int) error {
+		span := trace.SpanFromContext(ctxs[len(ctxs)-1])
+		ctxs = ctxs[:len(ctxs)-1]
+		if call.Returned {
+			span.End(trace.WithTimestamp(call.End))
+		} else {
+			span.End() // not returned yet when tracing stops
+		}
+		return nil
+	})
+}
+
+func (o *otlpOutput) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+	return errors.WithStack(o.provider.Shutdown(ctx))
+}
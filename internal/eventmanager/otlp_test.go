@@ -0,0 +1,64 @@
+package eventmanager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_OTLPOutput(t *testing.T) {
+	// the requests are checked in the test goroutine, require can't fail the test in the handler
+	type request struct {
+		path string
+		body []byte
+		err  error
+	}
+	reqs := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		reqs <- request{path: r.URL.Path, body: body, err: err}
+	}))
+	defer server.Close()
+
+	output, err := NewOutput("otlp="+server.URL, nil, OutputOptions{})
+	require.Nil(t, err)
+	root := newTestCalls()
+	require.Nil(t, output.Write(root))
+	require.Nil(t, output.Close())
+
+	r := <-reqs
+	require.Nil(t, r.err)
+	require.Equal(t, "/v1/traces", r.path)
+	req := &coltracepb.ExportTraceServiceRequest{}
+	require.Nil(t, proto.Unmarshal(r.body, req))
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+
+	byName := map[string]int{}
+	for i, span := range spans {
+		byName[span.Name] = i
+	}
+	doSomething, add := spans[byName["main.doSomething"]], spans[byName["main.add"]]
+	require.Empty(t, doSomething.ParentSpanId)
+	require.Equal(t, doSomething.SpanId, add.ParentSpanId)
+	require.Equal(t, doSomething.TraceId, add.TraceId)
+	require.Equal(t, uint64(root.Start.UnixNano()), doSomething.StartTimeUnixNano)
+	require.Equal(t, uint64(root.End.UnixNano()), doSomething.EndTimeUnixNano)
+
+	attrs := map[string]string{}
+	for _, attr := range add.Attributes {
+		attrs[attr.Key] = attr.Value.GetStringValue()
+	}
+	require.Equal(t, "1", attrs["ftrace.arg.a"])
+	require.Equal(t, "main.go:15", attrs["ftrace.call_site"])
+}
+
+func Test_OTLPEndpoint(t *testing.T) {
+	_, err := NewOutput("otlp=localhost:4318", nil, OutputOptions{})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,217 @@
+package eventmanager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+// Output outputs the call trees built from the traced events
+type Output interface {
+	// Write outputs the call tree of a root call, some calls may not have
+	// returned if tracing stops before that.
+	Write(root *Call) error
+	// Close flushes the buffered data, and closes the output.
+	Close() error
+}
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "json", "json-tree", "chrome-trace", "folded", "pprof", "otlp", "summary"}
+
+// OutputOptions options of the outputs
+type OutputOptions struct {
+	// Time is the timestamp mode of the text output, see TimeModes:
+	//
+	//   - wall: wall time of the events, default
+	//   - relative: seconds since the first event printed
+	//   - delta: seconds since the previous event printed
+	//   - none: timestamps not printed
+	Time string
+	// Color is the color mode of the text output, see ColorModes:
+	//
+	//   - auto: colored if it's written to a terminal, default
+	//   - always: always colored
+	//   - never: never colored
+	Color string
+}
+
+// ColorModes lists the color modes of the text output
+var ColorModes = []string{"auto", "always", "never"}
+
+// colored reports whether the text output written to `w` is colored
+func (opts OutputOptions) colored(w io.Writer) bool {
+	switch opts.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd()) && os.Getenv("TERM") != "dumb" && os.Getenv("NO_COLOR") == ""
+}
+
+// wholeDocument reports whether the output of `format` is a single document,
+// which is invalid if it's split into the rotated files.
+func wholeDocument(format string) bool {
+	return format == "chrome-trace" || format == "pprof"
+}
+
+// NewOutput creates the Output specified by `spec`, which is `format` or
+// `format=file`, the output is written to `w` if file is not specified.
+//
+//   - text: colored text, like ftrace(1)
+//   - json: JSON Lines, one object per entry/return event
+//   - json-tree: JSON Lines, one object per root call tree
+//   - chrome-trace: Chrome Trace Event format, opened by Perfetto or chrome://tracing
+//   - folded: folded stacks weighted by self time, rendered by flamegraph.pl
+//   - pprof: pprof profile of calls and wall time, opened by `go tool pprof`
+//   - otlp: OpenTelemetry spans exported via OTLP, `otlp=endpoint` instead of
+//     a file, see newOTLPOutput
+//   - summary: statistics and latency histogram of each function, printed
+//     when tracing stops, or every interval specified by `summary=10s`
+func NewOutput(spec string, w io.Writer, opts OutputOptions) (_ Output, err error) {
+	format, filename, _ := strings.Cut(spec, "=")
+	switch format {
+	case "otlp":
+		return newOTLPOutput(filename)
+	case "summary":
+		var interval time.Duration
+		if filename != "" {
+			if interval, err = time.ParseDuration(filename); err != nil {
+				return nil, errors.Wrapf(err, "invalid summary interval %s", filename)
+			}
+		}
+		return newSummaryOutput(w, interval), nil
+	}
+
+	var f *os.File
+	if filename != "" {
+		if f, err = os.Create(filename); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		w = bufio.NewWriter(f)
+	}
+
+	var output Output
+	switch format {
+	case "", "text":
+		output = &textOutput{w: w, timeMode: opts.Time, color: opts.colored(w)}
+	case "json":
+		output = newJSONOutput(w, false)
+	case "json-tree":
+		output = newJSONOutput(w, true)
+	case "chrome-trace":
+		output = newChromeTraceOutput(w)
+	case "folded":
+		output = newFoldedOutput(w)
+	case "pprof":
+		output = newPprofOutput(w)
+	default:
+		if f != nil {
+			f.Close()
+			os.Remove(filename)
+		}
+		return nil, fmt.Errorf("unknown output format: %s, supported: %s", format, strings.Join(Formats, ", "))
+	}
+	if f != nil {
+		output = &fileOutput{Output: output, w: w.(*bufio.Writer), f: f}
+	}
+	return output, nil
+}
+
+// NewOutputs creates the Outputs specified by `specs`, see NewOutput, all
+// call trees are written to each of them.
+//
+// If `w` is a RotateFile, it's rotated between the call trees, and closed
+// after the Outputs closed.
+func NewOutputs(specs []string, w io.Writer, opts OutputOptions) (output Output, err error) {
+	switch opts.Time {
+	case "", "wall", "relative", "delta", "none":
+	default:
+		return nil, fmt.Errorf("unknown time mode: %s, supported: %s", opts.Time, strings.Join(TimeModes, ", "))
+	}
+	switch opts.Color {
+	case "", "auto", "always", "never":
+	default:
+		return nil, fmt.Errorf("unknown color mode: %s, supported: %s", opts.Color, strings.Join(ColorModes, ", "))
+	}
+	if f, ok := w.(*RotateFile); ok && f.maxSize > 0 {
+		for _, spec := range specs {
+			if format, filename, _ := strings.Cut(spec, "="); wholeDocument(format) && filename == "" {
+				return nil, fmt.Errorf("%s output can't be rotated, write it to its own file like %s=file", format, format)
+			}
+		}
+	}
+	if len(specs) == 1 {
+		output, err = NewOutput(specs[0], w, opts)
+	} else {
+		outputs := multiOutput{}
+		for _, spec := range specs {
+			o, err := NewOutput(spec, w, opts)
+			if err != nil {
+				outputs.Close()
+				return nil, err
+			}
+			outputs = append(outputs, o)
+		}
+		output = outputs
+	}
+	if err != nil {
+		return
+	}
+	if f, ok := w.(*RotateFile); ok {
+		output = &rotateOutput{Output: output, f: f}
+	}
+	return output, nil
+}
+
+// fileOutput closes the file after the Output is closed
+type fileOutput struct {
+	Output
+	w *bufio.Writer
+	f *os.File
+}
+
+func (o *fileOutput) Close() error {
+	err := o.Output.Close()
+	if ferr := o.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.WithStack(err)
+}
+
+// MultiOutput creates an Output writing the call trees to each of `outputs`,
+// they're closed in order.
+func MultiOutput(outputs ...Output) Output {
+	return multiOutput(outputs)
+}
+
+// multiOutput writes the call trees to multiple outputs
+type multiOutput []Output
+
+func (o multiOutput) Write(root *Call) error {
+	for _, output := range o {
+		if err := output.Write(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o multiOutput) Close() (err error) {
+	for _, output := range o {
+		if cerr := output.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
@@ -0,0 +1,407 @@
+package eventmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCalls returns the call tree: main.doSomething { main.add { } main.minus { }
+func newTestCalls() *Call {
+	start := time.Date(2023, 12, 23, 17, 11, 0, 0, time.UTC)
+	root := &Call{Goid: 1, Function: "main.doSomething", Caller: "main.main+15", CallSite: "main.go:10",
+		Start: start, StartNs: 1000, Returned: true, RetFunc: "main.doSomething", RetOffset: 180,
+		RetSite: "main.go:22", End: start.Add(900 * time.Nanosecond), EndNs: 1900}
+	add := &Call{Goid: 1, Function: "main.add", Args: []Arg{{"a", "1"}, {"b", "2"}}, Caller: "main.doSomething+37",
+		CallSite: "main.go:15", Start: start.Add(100 * time.Nanosecond), StartNs: 1100, Returned: true,
+		RetFunc: "main.add", RetOffset: 154, RetSite: "main.go:27", End: start.Add(300 * time.Nanosecond), EndNs: 1300, Parent: root}
+	minus := &Call{Goid: 1, Function: "main.minus", Caller: "main.doSomething+52", CallSite: "main.go:16",
+		Start: start.Add(400 * time.Nanosecond), StartNs: 1400, Parent: root}
+	root.Children = []*Call{add, minus}
+	return root
+}
+
+func Test_JSONOutput(t *testing.T) {
+	root := newTestCalls()
+	add := root.Children[0]
+	add.Args = []Arg{{"b", "2"}, {"a", "1"}}
+
+	buf := &bytes.Buffer{}
+	output, err := NewOutput("json", buf, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Write(root))
+
+	// JSON Lines, each line is an object with the fields documented in README
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		event := map[string]interface{}{}
+		require.Nil(t, json.Unmarshal([]byte(line), &event), line)
+		for _, key := range []string{"goid", "event", "depth", "function", "file", "time", "time_ns"} {
+			require.Contains(t, event, key, line)
+		}
+		_, err := time.Parse(time.RFC3339Nano, event["time"].(string))
+		require.Nil(t, err)
+		events = append(events, event)
+	}
+	require.Equal(t, []string{"entry main.doSomething", "entry main.add", "return main.add", "entry main.minus", "return main.doSomething"},
+		eventNames(events))
+
+	// args keep the order of the fetch spec
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"name": "b", "value": "2"},
+		map[string]interface{}{"name": "a", "value": "1"},
+	}, events[1]["args"])
+	require.Equal(t, "main.doSomething+37", events[1]["caller"])
+	require.Equal(t, "main.go:15", events[1]["file"])
+	require.Equal(t, "main.go:27", events[2]["file"])
+	require.Equal(t, float64(add.Duration()), events[2]["duration_ns"])
+	require.NotContains(t, events[0], "args")
+}
+
+// eventNames returns the events and functions of the JSON events
+func eventNames(events []map[string]interface{}) (names []string) {
+	for _, event := range events {
+		names = append(names, fmt.Sprintf("%s %s", event["event"], event["function"]))
+	}
+	return
+}
+
+func Test_JSONTreeOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	output, err := NewOutput("json-tree", buf, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Write(newTestCalls()))
+	require.Nil(t, output.Write(newTestCalls()))
+
+	// one object per root call, the children are nested
+	dec := json.NewDecoder(buf)
+	for i := 0; i < 2; i++ {
+		root := jsonCall{}
+		require.Nil(t, dec.Decode(&root))
+		require.Equal(t, "main.doSomething", root.Function)
+		require.Equal(t, []string{"main.add", "main.minus"}, []string{root.Children[0].Function, root.Children[1].Function})
+		for _, call := range append([]*jsonCall{&root}, root.Children...) {
+			if !call.Returned {
+				require.Nil(t, call.End)
+				require.Empty(t, call.RetSite)
+				continue
+			}
+			require.Equal(t, int64(call.EndNs-call.StartNs), call.DurationNs)
+			require.Equal(t, call.End.Sub(call.Start).Nanoseconds(), call.DurationNs)
+		}
+		require.Equal(t, []jsonArg{{"a", "1"}, {"b", "2"}}, root.Children[0].Args)
+	}
+	require.Equal(t, io.EOF, dec.Decode(&jsonCall{}))
+}
+
+func Test_UnknownOutput(t *testing.T) {
+	_, err := NewOutput("xml", &bytes.Buffer{}, OutputOptions{})
+	require.NotNil(t, err)
+}
+
+func Test_ChromeTraceOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "trace.json")
+	output, err := NewOutputs([]string{"chrome-trace=" + filename}, &bytes.Buffer{}, OutputOptions{})
+	require.Nil(t, err)
+	root := newTestCalls()
+	require.Nil(t, output.Write(root))
+	other := newTestCalls()
+	other.Goid = 2
+	require.Nil(t, output.Write(other))
+	require.Nil(t, output.Close())
+
+	// the JSON Object Format, every event has the required fields
+	data, err := os.ReadFile(filename)
+	require.Nil(t, err)
+	doc := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(data, &doc))
+	require.Equal(t, "ns", doc["displayTimeUnit"])
+	events := doc["traceEvents"].([]interface{})
+	require.Len(t, events, 8)
+	for _, e := range events {
+		event := e.(map[string]interface{})
+		require.IsType(t, "", event["name"])
+		require.Contains(t, []string{"M", "X", "B"}, event["ph"])
+		require.IsType(t, float64(0), event["pid"])
+		require.IsType(t, float64(0), event["tid"])
+		require.IsType(t, float64(0), event["ts"])
+		if event["ph"] == "X" {
+			require.GreaterOrEqual(t, event["dur"].(float64), float64(0))
+		}
+	}
+
+	// it round-trips through chromeTraceEvent, nothing is lost
+	trace := struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{}
+	require.Nil(t, json.Unmarshal(data, &trace))
+	again, err := json.Marshal(trace)
+	require.Nil(t, err)
+	require.JSONEq(t, string(data), string(again))
+
+	// a goroutine is a thread track named once, the callees are nested in the callers
+	require.Equal(t, []string{"M goroutine 1", "X main.doSomething", "X main.add", "B main.minus", "M goroutine 2"},
+		chromeTraceNames(trace.TraceEvents[:5]))
+	doSomething, add := trace.TraceEvents[1], trace.TraceEvents[2]
+	require.Equal(t, doSomething.Tid, add.Tid)
+	require.GreaterOrEqual(t, add.Ts, doSomething.Ts)
+	require.LessOrEqual(t, add.Ts+*add.Dur, doSomething.Ts+*doSomething.Dur)
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, add.Args)
+	require.Equal(t, uint64(2), trace.TraceEvents[5].Tid)
+
+	// an empty trace is valid too
+	buf := &bytes.Buffer{}
+	output, err = NewOutput("chrome-trace", buf, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Close())
+	require.JSONEq(t, `{"traceEvents":[]}`, buf.String())
+}
+
+// chromeTraceNames returns the phases and names of trace events, or thread names
+func chromeTraceNames(events []chromeTraceEvent) (names []string) {
+	for _, event := range events {
+		name := event.Name
+		if event.Ph == "M" {
+			name = event.Args["name"]
+		}
+		names = append(names, event.Ph+" "+name)
+	}
+	return
+}
+
+func Test_FoldedOutput(t *testing.T) {
+	root := newTestCalls()
+	generic := &Call{Goid: 1, Function: "main.F[go.shape.struct { a int; b int }]",
+		StartNs: 1400, Returned: true, EndNs: 1500, Parent: root}
+	root.Children = append(root.Children, generic)
+
+	buf := &bytes.Buffer{}
+	output, err := NewOutput("folded", buf, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Write(root))
+	require.Nil(t, output.Write(root))
+	require.Nil(t, output.Close())
+
+	// each line is `frame;frame;... <count>` as parsed by flamegraph.pl,
+	// the counts sum up to the self time of all the calls
+	stacks := map[string]int64{}
+	var total int64
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		i := strings.LastIndex(line, " ")
+		require.Greater(t, i, 0, line)
+		count, err := strconv.ParseInt(line[i+1:], 10, 64)
+		require.Nil(t, err, line)
+		require.Greater(t, count, int64(0), line)
+		frames := strings.Split(line[:i], ";")
+		for _, frame := range frames {
+			require.NotEmpty(t, frame, line)
+		}
+		require.Equal(t, "main.doSomething", frames[0], line)
+		stacks[line[:i]] = count
+		total += count
+	}
+	require.Equal(t, 2*int64(root.Duration()), total) // main.minus hasn't returned
+	require.Equal(t, map[string]int64{
+		"main.doSomething":          1200,
+		"main.doSomething;main.add": 400,
+		"main.doSomething;main.F[go.shape.struct { a int, b int }]": 200,
+	}, stacks)
+}
+
+func Test_PprofOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.pb.gz")
+	output, err := NewOutputs([]string{"pprof=" + filename}, &bytes.Buffer{}, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Write(newTestCalls()))
+	require.Nil(t, output.Write(newTestCalls()))
+	require.Nil(t, output.Close())
+
+	f, err := os.Open(filename)
+	require.Nil(t, err)
+	defer f.Close()
+	p, err := profile.Parse(f)
+	require.Nil(t, err)
+	require.Nil(t, p.CheckValid())
+	require.Equal(t, int64(900), p.DurationNanos)
+
+	stacks := map[string][]int64{}
+	for _, sample := range p.Sample {
+		frames := []string{}
+		for _, loc := range sample.Location {
+			frames = append(frames, fmt.Sprintf("%s:%d", loc.Line[0].Function.Name, loc.Line[0].Line))
+		}
+		stacks[strings.Join(frames, ";")] = sample.Value
+	}
+	require.Equal(t, map[string][]int64{
+		"main.doSomething:22":              {2, 1400},
+		"main.add:27;main.doSomething:15":  {2, 400},
+		"main.minus:0;main.doSomething:16": {2, 0},
+	}, stacks)
+
+	// go tool pprof reads it, flat is the self time and cum is the total time,
+	// calls without time aren't listed
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	out, err := exec.Command("go", "tool", "pprof", "-top", "-sample_index=1", "-unit=ns", filename).CombinedOutput()
+	require.Nil(t, err, string(out))
+	top := map[string][]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) == 6 && strings.HasPrefix(fields[5], "main.") {
+			top[fields[5]] = []string{fields[0], fields[3]}
+		}
+	}
+	require.Equal(t, map[string][]string{
+		"main.doSomething": {"1400ns", "1800ns"},
+		"main.add":         {"400ns", "400ns"},
+	}, top)
+}
+
+func Test_SummaryOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	output, err := NewOutput("summary", buf, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Write(newTestCalls()))
+	require.Nil(t, output.Write(newTestCalls()))
+	require.Nil(t, output.Close())
+
+	lines := strings.Split(buf.String(), "\n")
+	require.Contains(t, lines[1], "summary of")
+	require.Equal(t, []string{"CALLS", "TOTAL", "SELF", "MIN", "AVG", "MAX", "P50", "P90", "P99", "FUNCTION"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"2", "1.8µs", "1.4µs", "900ns", "900ns", "900ns", "900ns", "900ns", "900ns", "main.doSomething"}, strings.Fields(lines[3]))
+	require.Equal(t, []string{"2", "400ns", "400ns", "200ns", "200ns", "200ns", "200ns", "200ns", "200ns", "main.add"}, strings.Fields(lines[4]))
+	require.Contains(t, buf.String(), "      512 -> 1023      : 2        |****************************************|")
+}
+
+func Test_LatencyPercentile(t *testing.T) {
+	s := &funcStats{hist: map[int]int64{}}
+	for i := 1; i <= 1000; i++ {
+		s.add(&Call{Returned: true, StartNs: 0, EndNs: uint64(i) * 1000})
+	}
+	for _, p := range []float64{0.5, 0.9, 0.99} {
+		want := time.Duration(p*1000) * time.Microsecond
+		require.InEpsilon(t, float64(want), float64(s.percentile(p)), 1.0/subBuckets)
+	}
+	require.Equal(t, time.Millisecond, s.percentile(1))
+
+	// the histogram stays bounded however many distinct latencies there are
+	for i := 1; i <= 1000000; i++ {
+		s.add(&Call{Returned: true, StartNs: 0, EndNs: uint64(i) * 4099})
+	}
+	require.LessOrEqual(t, len(s.hist), 64*subBuckets)
+}
+
+func Test_RotateFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "trace.log")
+	f, err := CreateRotateFile(filename, 100, 2)
+	require.Nil(t, err)
+	output, err := NewOutputs([]string{"json-tree"}, f, OutputOptions{})
+	require.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		require.Nil(t, output.Write(newTestCalls()))
+	}
+	require.Nil(t, output.Close())
+
+	// each call tree exceeds 100 bytes, and is never split
+	for _, name := range []string{filename, filename + ".1", filename + ".2"} {
+		data, err := os.ReadFile(name)
+		require.Nil(t, err)
+		if name == filename {
+			require.Empty(t, data)
+			continue
+		}
+		require.Equal(t, 1, bytes.Count(data, []byte("\n")))
+	}
+	_, err = os.Stat(filename + ".3")
+	require.True(t, os.IsNotExist(err))
+}
+
+func Test_RotateWholeDocument(t *testing.T) {
+	dir := t.TempDir()
+	f, err := CreateRotateFile(filepath.Join(dir, "trace.log"), 100, 2)
+	require.Nil(t, err)
+	defer f.Close()
+
+	// a JSON array or a profile is invalid if it's split into rotated files
+	for _, format := range []string{"chrome-trace", "pprof"} {
+		_, err = NewOutputs([]string{"text", format}, f, OutputOptions{})
+		require.NotNil(t, err, format)
+	}
+	output, err := NewOutputs([]string{"text", "chrome-trace=" + filepath.Join(dir, "trace.json")}, f, OutputOptions{})
+	require.Nil(t, err)
+	require.Nil(t, output.Close())
+}
+
+func Test_RotateFileConcurrent(t *testing.T) {
+	f, err := CreateRotateFile(filepath.Join(t.TempDir(), "trace.log"), 100, 2)
+	require.Nil(t, err)
+	output, err := NewOutputs([]string{"text", "summary=1ms"}, f, OutputOptions{})
+	require.Nil(t, err)
+	// the summary is printed from its own goroutine while the file rotates
+	for i := 0; i < 20; i++ {
+		require.Nil(t, output.Write(newTestCalls()))
+		time.Sleep(100 * time.Microsecond)
+	}
+	require.Nil(t, output.Close())
+}
+
+func Test_TextOutputColor(t *testing.T) {
+	text := func(mode string) string {
+		buf := &bytes.Buffer{}
+		output, err := NewOutput("text", buf, OutputOptions{Color: mode})
+		require.Nil(t, err)
+		require.Nil(t, output.Write(newTestCalls()))
+		return buf.String()
+	}
+	require.Contains(t, text("always"), "\x1b[31mmain.add")
+	require.NotContains(t, text("auto"), "\x1b[")
+	require.NotContains(t, text("never"), "\x1b[")
+
+	// a file is never colored in auto mode, even if stdout is a terminal
+	f, err := os.Create(filepath.Join(t.TempDir(), "trace.txt"))
+	require.Nil(t, err)
+	defer f.Close()
+	require.False(t, OutputOptions{}.colored(f))
+	require.True(t, OutputOptions{Color: "always"}.colored(f))
+
+	_, err = NewOutputs([]string{"text"}, &bytes.Buffer{}, OutputOptions{Color: "sometimes"})
+	require.NotNil(t, err)
+}
+
+func Test_TextOutputTime(t *testing.T) {
+	start := time.Date(2023, 12, 23, 17, 11, 0, 0, time.UTC)
+	root := &Call{Function: "main.doSomething", Start: start, StartNs: 1000000,
+		Returned: true, End: start.Add(2500 * time.Microsecond), EndNs: 3500000}
+	root.Children = []*Call{{Function: "main.add", Start: start.Add(250 * time.Microsecond), StartNs: 1250000,
+		Returned: true, End: start.Add(time.Millisecond), EndNs: 2000000, Parent: root}}
+
+	timestamps := func(mode string) (ts []string) {
+		buf := &bytes.Buffer{}
+		output, err := NewOutput("text", buf, OutputOptions{Time: mode})
+		require.Nil(t, err)
+		require.Nil(t, output.Write(root))
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			ts = append(ts, strings.Fields(line)[0]+" "+strings.Fields(line)[1])
+		}
+		return
+	}
+	require.Equal(t, []string{"23 17:11:00.000000", "23 17:11:00.000250", "23 17:11:00.001000", "23 17:11:00.002500"}, timestamps("wall"))
+	require.Equal(t, []string{"0.000000 main.doSomething()", "0.000250 main.add()", "0.001000 000.0008", "0.002500 000.0025"}, timestamps("relative"))
+	require.Equal(t, []string{"+0.000000 main.doSomething()", "+0.000250 main.add()", "+0.000750 000.0008", "+0.001500 000.0025"}, timestamps("delta"))
+	require.Equal(t, []string{"main.doSomething() {", "main.add() {", "000.0008 }", "000.0025 }"}, timestamps("none"))
+
+	_, err := NewOutputs([]string{"text"}, &bytes.Buffer{}, OutputOptions{Time: "utc"})
+	require.NotNil(t, err)
+}
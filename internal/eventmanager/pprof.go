@@ -0,0 +1,127 @@
+package eventmanager
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// pprofOutput writes the call trees as a pprof profile, which is opened by
+// `go tool pprof` when it's closed.
+//
+// Each call is a sample of its callstack in the call tree, the values are
+// the count of calls and the wall time excluding the returned children, so
+// flat is the self time and cum is the total time of a function. The frame
+// of a caller is located at the call site of the callee, and the frame of
+// a leaf call is located at its RET instruction.
+type pprofOutput struct {
+	w io.Writer
+	p *profile.Profile
+
+	samples   map[string]*profile.Sample // k=location ids of the callstack
+	locations map[string]*profile.Location
+	functions map[string]*profile.Function
+	start     uint64 // bpf_ktime_get_ns of the first call
+	end       uint64 // bpf_ktime_get_ns of the last return
+}
+
+func newPprofOutput(w io.Writer) *pprofOutput {
+	return &pprofOutput{
+		w: w,
+		p: &profile.Profile{
+			SampleType: []*profile.ValueType{
+				{Type: "calls", Unit: "count"},
+				{Type: "wall", Unit: "nanoseconds"},
+			},
+			DefaultSampleType: "wall",
+		},
+		samples:   map[string]*profile.Sample{},
+		locations: map[string]*profile.Location{},
+		functions: map[string]*profile.Function{},
+	}
+}
+
+func (o *pprofOutput) Write(root *Call) error {
+	if o.start == 0 || root.StartNs < o.start {
+		o.p.TimeNanos, o.start = root.Start.UnixNano(), root.StartNs
+	}
+
+	// frames of the callers, the leaf frame is at the top
+	var stack []*profile.Location
+	return root.Walk(func(call *Call, depth int) error {
+		if call.Returned && call.EndNs > o.end {
+			o.end = call.EndNs
+		}
+		if len(stack) > 0 {
+			// the caller is executing at the call site now
+			caller := call.Parent
+			stack[len(stack)-1] = o.location(caller.Function, call.CallSite)
+		}
+		stack = append(stack, o.location(call.Function, call.RetSite))
+
+		key := make([]string, len(stack))
+		for i, loc := range stack {
+			key[i] = strconv.FormatUint(loc.ID, 10)
+		}
+		sample, ok := o.samples[strings.Join(key, ",")]
+		if !ok {
+			sample = &profile.Sample{Value: []int64{0, 0}}
+			for i := len(stack) - 1; i >= 0; i-- {
+				sample.Location = append(sample.Location, stack[i])
+			}
+			o.samples[strings.Join(key, ",")] = sample
+			o.p.Sample = append(o.p.Sample, sample)
+		}
+		sample.Value[0]++
+		sample.Value[1] += int64(call.SelfTime())
+		return nil
+	}, func(call *Call, depth int) error {
+		stack = stack[:len(stack)-1]
+		return nil
+	})
+}
+
+// location returns the location in function `funcname` at `site`, like: main.go:10
+func (o *pprofOutput) location(funcname, site string) *profile.Location {
+	filename, line := "?", 0
+	if idx := strings.LastIndex(site, ":"); idx > 0 {
+		filename = site[:idx]
+		line, _ = strconv.Atoi(site[idx+1:])
+	}
+
+	fn, ok := o.functions[funcname]
+	if !ok {
+		fn = &profile.Function{
+			ID:         uint64(len(o.p.Function) + 1),
+			Name:       funcname,
+			SystemName: funcname,
+			Filename:   filename,
+		}
+		o.functions[funcname] = fn
+		o.p.Function = append(o.p.Function, fn)
+	}
+
+	key := funcname + "@" + site
+	loc, ok := o.locations[key]
+	if !ok {
+		loc = &profile.Location{
+			ID:   uint64(len(o.p.Location) + 1),
+			Line: []profile.Line{{Function: fn, Line: int64(line)}},
+		}
+		o.locations[key] = loc
+		o.p.Location = append(o.p.Location, loc)
+	}
+	return loc
+}
+
+func (o *pprofOutput) Close() error {
+	if o.end > o.start {
+		o.p.DurationNanos = int64(o.end - o.start)
+	}
+	if err := o.p.CheckValid(); err != nil {
+		return err
+	}
+	return o.p.Write(o.w)
+}
@@ -2,7 +2,9 @@ package eventmanager
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
@@ -11,62 +13,105 @@ import (
 
 const placeholder = "        "
 
-// PrintStack print the callstack of a traced function
+// PrintStack outputs the callstack of a traced function, re-rooted at the
+// drilldown calls if specified, and the returned ones faster than the min
+// duration are dropped.
 func (m *EventManager) PrintStack(goid uint64) (err error) {
-	indent := ""
-	fmt.Println()
-	startTimeStack := []uint64{}
-	for _, event := range m.goEvents[goid] {
-		lineInfo := "?:?"
-		t := m.bootTime.Add(time.Duration(event.TimeNs)).Format("02 15:04:05.0000")
-		syms, offset, err := m.elf.ResolveAddress(event.Ip)
-		if err != nil {
-			return err
+	roots, err := m.BuildCalls(goid)
+	if err != nil {
+		return
+	}
+	for _, root := range m.drilldownCalls(roots) {
+		if root.Returned {
+			if root.Duration() < m.minDuration {
+				continue
+			}
+			m.roots++
+		}
+		if err = m.output.Write(root); err != nil {
+			return
 		}
+	}
+	return
+}
 
-		switch event.Location {
-		case 0: // entpoint
-			startTimeStack = append(startTimeStack, event.TimeNs)
-			callChain, err := m.SprintCallChain(event)
-			if err != nil {
-				return err
-			}
-			if filename, line, err := m.elf.LineInfoForPc(event.CallerIp); err == nil {
-				lineInfo = fmt.Sprintf("%s:%d", filename, line)
-			}
+// TimeModes lists the timestamp modes of the text output
+var TimeModes = []string{"wall", "relative", "delta", "none"}
 
-			fmt.Printf("%s %s %s %s(%s) { %s %s\n",
-				color.YellowString(t),
-				placeholder,
-				indent,
-				color.RedString(event.uprobe.Funcname),
-				color.MagentaString(event.argString),
-				color.GreenString(callChain),
-				color.CyanString(lineInfo))
-			indent += "  "
+// textOutput prints the call trees as colored text, like ftrace(1)
+type textOutput struct {
+	w        io.Writer
+	timeMode string // see TimeModes
+	color    bool   // color the text, see OutputOptions.Color
 
-		case 1: // retpoint
-			if len(indent) == 0 {
-				continue
-			}
-			if filename, line, err := m.elf.LineInfoForPc(event.Ip); err == nil {
-				lineInfo = fmt.Sprintf("%s:%d", filename, line)
-			}
-			elapsed := event.TimeNs - startTimeStack[len(startTimeStack)-1]
-			startTimeStack = startTimeStack[:len(startTimeStack)-1]
-			indent = indent[:len(indent)-2]
-			fmt.Printf("%s %08.4f %s } %s+%d %s\n",
-				color.YellowString(t),
-				time.Duration(elapsed).Seconds(),
-				indent,
-				color.RedString(syms[0].Name),
-				offset,
-				color.CyanString(lineInfo))
+	first uint64 // bpf_ktime_get_ns of the first event printed
+	last  uint64 // bpf_ktime_get_ns of the last event printed
+}
+
+func (o *textOutput) Write(root *Call) error {
+	fmt.Fprintln(o.w)
+	return root.Walk(func(call *Call, depth int) error {
+		indent := strings.Repeat("  ", depth)
+		_, err := fmt.Fprintf(o.w, "%s%s %s %s(%s) { %s %s\n",
+			o.timestamp(call.Start, call.StartNs),
+			placeholder,
+			indent,
+			o.paint(color.FgRed, call.Function),
+			o.paint(color.FgMagenta, call.ArgString()),
+			o.paint(color.FgGreen, call.Caller),
+			o.paint(color.FgCyan, call.CallSite))
+		return err
+	}, func(call *Call, depth int) error {
+		if !call.Returned {
+			return nil
 		}
+		indent := strings.Repeat("  ", depth)
+		_, err := fmt.Fprintf(o.w, "%s%08.4f %s } %s+%d %s\n",
+			o.timestamp(call.End, call.EndNs),
+			call.Duration().Seconds(),
+			indent,
+			o.paint(color.FgRed, call.RetFunc),
+			call.RetOffset,
+			o.paint(color.FgCyan, call.RetSite))
+		return err
+	})
+}
+
+// timestamp returns the timestamp column of an event at `t`, or `ns` by
+// bpf_ktime_get_ns, it's empty if the timestamps are not printed.
+func (o *textOutput) timestamp(t time.Time, ns uint64) (ts string) {
+	if o.first == 0 {
+		o.first, o.last = ns, ns
 	}
-	return
+	switch o.timeMode {
+	case "none":
+		return ""
+	case "relative":
+		ts = fmt.Sprintf("%16.6f", float64(int64(ns-o.first))/1e9)
+	case "delta":
+		ts = fmt.Sprintf("%+16.6f", float64(int64(ns-o.last))/1e9)
+	default:
+		ts = t.Format("02 15:04:05.000000")
+	}
+	o.last = ns
+	return o.paint(color.FgYellow, ts) + " "
+}
+
+// paint colors `s` if the output is colored
+func (o *textOutput) paint(attr color.Attribute, s string) string {
+	if !o.color {
+		return s
+	}
+	c := color.New(attr)
+	c.EnableColor()
+	return c.Sprint(s)
+}
+
+func (o *textOutput) Close() error {
+	return nil
 }
 
+// SprintCallChain returns the caller of the event, like: main.main+15
 func (m *EventManager) SprintCallChain(event Event) (chain string, err error) {
 	if event.CallerIp == 0 {
 		return "", nil
@@ -92,11 +137,12 @@ func (m *EventManager) SprintArg(arg *uprobe.FetchArg, data []uint8) (_ string,
 		return "", err
 	}
 	if offset != 0 {
-		return "", fmt.Errorf("not a valid __call__ target: %lld", addr)
+		return "", fmt.Errorf("not a valid __call__ target: %d", addr)
 	}
 	return fmt.Sprintf("__call__=%s", syms[0].Name), nil
 }
 
+// PrintRemaining outputs the callstacks which haven't been closed when tracing stops
 func (m *EventManager) PrintRemaining() (err error) {
 	for goid := range m.goEvents {
 		if err = m.PrintStack(goid); err != nil {
@@ -0,0 +1,111 @@
+package eventmanager
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RotateFile is the file to write the outputs, it's rotated by size like
+// logrotate(8): file is renamed to file.1, file.1 to file.2 and so on.
+//
+// It's safe for concurrent use, e.g. the periodic summary is written from
+// its own goroutine.
+type RotateFile struct {
+	path    string
+	maxSize int64 // rotate if the file exceeds it, 0 means never rotate
+	backups int   // number of rotated files kept
+
+	mu   sync.Mutex
+	f    *os.File
+	bw   *bufio.Writer
+	size int64
+}
+
+// CreateRotateFile creates the file `path`, it's rotated after a call tree
+// written if it exceeds `maxSize`, and at most `backups` rotated files kept.
+func CreateRotateFile(path string, maxSize int64, backups int) (*RotateFile, error) {
+	f := &RotateFile{path: path, maxSize: maxSize, backups: backups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotateFile) open() (err error) {
+	if f.f, err = os.Create(f.path); err != nil {
+		return errors.WithStack(err)
+	}
+	f.bw = bufio.NewWriter(f.f)
+	f.size = 0
+	return nil
+}
+
+func (f *RotateFile) Write(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err = f.bw.Write(p)
+	f.size += int64(n)
+	return
+}
+
+// rotate rotates the file if it exceeds the max size
+func (f *RotateFile) rotate() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize <= 0 || f.size < f.maxSize {
+		return nil
+	}
+	if err = f.close(); err != nil {
+		return
+	}
+	if f.backups > 0 {
+		for i := f.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err = os.Rename(f.path, f.path+".1"); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return f.open()
+}
+
+func (f *RotateFile) close() error {
+	err := f.bw.Flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.WithStack(err)
+}
+
+// Close flushes the buffered data and closes the file
+func (f *RotateFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.close()
+}
+
+// rotateOutput rotates the RotateFile between the call trees, so a call tree
+// is never split into 2 files.
+type rotateOutput struct {
+	Output
+	f *RotateFile
+}
+
+func (o *rotateOutput) Write(root *Call) error {
+	if err := o.Output.Write(root); err != nil {
+		return err
+	}
+	return o.f.rotate()
+}
+
+func (o *rotateOutput) Close() error {
+	err := o.Output.Close()
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package eventmanager
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// subBuckets is the number of linear sub-buckets in a log2 bucket of latency,
+// the percentiles are estimated by them within 1/subBuckets error.
+const subBuckets = 16
+
+// funcStats is the statistics of the returned calls of a function
+type funcStats struct {
+	name  string
+	count int64
+	total time.Duration
+	self  time.Duration
+	min   time.Duration
+	max   time.Duration
+	hist  map[int]int64 // k=log-linear bucket of latency in nanoseconds
+}
+
+func (s *funcStats) add(call *Call) {
+	d := call.Duration()
+	if s.count == 0 || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	s.count++
+	s.total += d
+	s.self += call.SelfTime()
+	s.hist[latencyBucket(d)]++
+}
+
+// percentile estimates the latency at percentile `p` from the histogram
+func (s *funcStats) percentile(p float64) time.Duration {
+	buckets := make([]int, 0, len(s.hist))
+	for b := range s.hist {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+
+	rank := int64(p * float64(s.count))
+	var n int64
+	for _, b := range buckets {
+		if n += s.hist[b]; n > rank {
+			d := bucketUpper(b)
+			if d > s.max {
+				d = s.max
+			}
+			return d
+		}
+	}
+	return s.max
+}
+
+// latencyBucket returns the log-linear bucket of `d`: the log2 bucket is
+// split into subBuckets linear sub-buckets.
+func latencyBucket(d time.Duration) int {
+	ns := uint64(d)
+	if ns < subBuckets {
+		return int(ns)
+	}
+	exp := bits.Len64(ns) - 1 // ns in [2^exp, 2^(exp+1))
+	sub := (ns >> (exp - 4)) & (subBuckets - 1)
+	return (exp-3)*subBuckets + int(sub)
+}
+
+// bucketUpper returns the upper bound (exclusive) of the bucket `b`
+func bucketUpper(b int) time.Duration {
+	if b < subBuckets {
+		return time.Duration(b + 1)
+	}
+	exp := b/subBuckets + 3
+	sub := uint64(b % subBuckets)
+	return time.Duration((subBuckets + sub + 1) << (exp - 4))
+}
+
+// summaryOutput aggregates the statistics of each function instead of
+// outputting the call trees, it prints the summary when it's closed, or
+// every `interval` and the statistics are reset after printed.
+type summaryOutput struct {
+	w        io.Writer
+	interval time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*funcStats
+	start time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSummaryOutput(w io.Writer, interval time.Duration) *summaryOutput {
+	o := &summaryOutput{
+		w:        w,
+		interval: interval,
+		stats:    map[string]*funcStats{},
+		start:    time.Now(),
+	}
+	if interval > 0 {
+		o.stop, o.done = make(chan struct{}), make(chan struct{})
+		go o.printEvery()
+	}
+	return o
+}
+
+func (o *summaryOutput) Write(root *Call) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return root.Walk(func(call *Call, depth int) error {
+		if !call.Returned {
+			return nil
+		}
+		s, ok := o.stats[call.Function]
+		if !ok {
+			s = &funcStats{name: call.Function, hist: map[int]int64{}}
+			o.stats[call.Function] = s
+		}
+		s.add(call)
+		return nil
+	}, nil)
+}
+
+func (o *summaryOutput) printEvery() {
+	defer close(o.done)
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			if err := o.print(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// print prints the summary, and resets the statistics
+func (o *summaryOutput) print() (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]*funcStats, 0, len(o.stats))
+	for _, s := range o.stats {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].total > stats[j].total })
+
+	fmt.Fprintf(o.w, "\n%s summary of %v, %d functions\n",
+		now.Format("15:04:05"), now.Sub(o.start).Round(time.Millisecond), len(stats))
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CALLS\tTOTAL\tSELF\tMIN\tAVG\tMAX\tP50\tP90\tP99\t\tFUNCTION")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%d\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\t%s\n",
+			s.count, s.total, s.self, s.min, s.total/time.Duration(s.count), s.max,
+			s.percentile(0.5), s.percentile(0.9), s.percentile(0.99), s.name)
+	}
+	if err = tw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, s := range stats {
+		if err = printHistogram(o.w, s); err != nil {
+			return
+		}
+	}
+
+	o.stats, o.start = map[string]*funcStats{}, now
+	return nil
+}
+
+// printHistogram prints the log2 histogram of latency like funclatency(8)
+func printHistogram(w io.Writer, s *funcStats) error {
+	log2 := map[int]int64{} // k=n, latency in [2^(n-1), 2^n)
+	lo, hi, max := 64, 0, int64(0)
+	for b, count := range s.hist {
+		n := bits.Len64(uint64(bucketUpper(b) - 1))
+		log2[n] += count
+		if n < lo {
+			lo = n
+		}
+		if n > hi {
+			hi = n
+		}
+	}
+	for _, count := range log2 {
+		if count > max {
+			max = count
+		}
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "\n%s\n%23s : %-8s %s\n", s.name, "nsecs", "count", "distribution")
+	for n := lo; n <= hi; n++ {
+		from, to := uint64(0), uint64(0)
+		if n > 0 {
+			from, to = 1<<(n-1), 1<<n-1
+		}
+		stars := int(log2[n] * 40 / max)
+		fmt.Fprintf(sb, "%9d -> %-9d : %-8d |%-40s|\n", from, to, log2[n], strings.Repeat("*", stars))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return errors.WithStack(err)
+}
+
+func (o *summaryOutput) Close() error {
+	if o.interval > 0 {
+		close(o.stop)
+		<-o.done
+	}
+	return o.print()
+}
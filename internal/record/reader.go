@@ -0,0 +1,172 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"os"
+
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/pkg/errors"
+)
+
+// eventBuffer is the number of events decoded ahead of the handler, an arg
+// may be recorded after its event, and the handler waits for it meanwhile.
+const eventBuffer = 1000
+
+// Reader reads the events of a tracing session from a trace file
+type Reader struct {
+	path     string
+	Header   *Header
+	Snapshot *Snapshot
+	args     chan bpf.GoftraceArgData
+}
+
+// Open opens the trace file `path`, and reads the Header and Snapshot
+func Open(path string) (_ *Reader, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	r := &Reader{path: path, args: make(chan bpf.GoftraceArgData)}
+	if r.Header, _, err = r.decodeHeader(f); err != nil {
+		return
+	}
+	if r.Snapshot, err = r.decodeSnapshot(f); err != nil {
+		return
+	}
+	return r, nil
+}
+
+// Args returns the fetched arguments in the trace file, like bpf.PollArg.
+// They're sent while Events decodes the records, so they must be received
+// in background meanwhile, and the channel is closed when Events returns.
+func (r *Reader) Args() <-chan bpf.GoftraceArgData {
+	return r.args
+}
+
+// Events decodes the records in the trace file once, sends the arguments to
+// Args and calls `fn` with the events one by one, it stops if `fn` returns
+// an error.
+func (r *Reader) Events(fn func(event bpf.GoftraceEvent) error) (err error) {
+	events := make(chan bpf.GoftraceEvent, eventBuffer)
+	done := make(chan struct{})
+	decodeErr := make(chan error, 1)
+	go func() {
+		defer close(r.args)
+		defer close(events)
+		decodeErr <- r.scan(func(rec *record) error {
+			switch {
+			case rec.Arg != nil:
+				select {
+				case r.args <- *rec.Arg:
+				case <-done:
+					return errStopped
+				}
+			case rec.Event != nil:
+				select {
+				case events <- *rec.Event:
+				case <-done:
+					return errStopped
+				}
+			}
+			return nil
+		})
+	}()
+
+	for event := range events {
+		if err = fn(event); err != nil {
+			close(done)
+			<-decodeErr
+			return
+		}
+	}
+	return <-decodeErr
+}
+
+// errStopped stops decoding the records when the events are not handled anymore
+var errStopped = errors.New("stopped")
+
+// scan decodes the records one by one after the Header
+func (r *Reader) scan(fn func(rec *record) error) (err error) {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	_, dec, err := r.decodeHeader(f)
+	if err != nil {
+		return
+	}
+	for {
+		rec := &record{}
+		if err = dec.Decode(rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "invalid trace file %s", r.path)
+		}
+		if err = fn(rec); err != nil {
+			return
+		}
+	}
+}
+
+// decodeHeader reads the magic and the Header at the beginning of `f`, and
+// returns the decoder of the records following it.
+func (r *Reader) decodeHeader(f *os.File) (header *Header, dec *gob.Decoder, err error) {
+	br := bufio.NewReader(f)
+	magic := make([]byte, len(Magic))
+	if _, err = io.ReadFull(br, magic); err != nil || string(magic) != Magic {
+		return nil, nil, errors.Errorf("invalid trace file %s, bad magic", r.path)
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid trace file %s", r.path)
+	}
+	// the Snapshot is another gzip member
+	zr.Multistream(false)
+	dec = gob.NewDecoder(zr)
+	header = &Header{}
+	if err = dec.Decode(header); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid trace file %s", r.path)
+	}
+	return header, dec, nil
+}
+
+// decodeSnapshot reads the Snapshot at the offset in the footer of `f`
+func (r *Reader) decodeSnapshot(f *os.File) (_ *Snapshot, err error) {
+	// the recording process is killed before the trace file closed
+	notFound := errors.Errorf("invalid trace file %s, symbol snapshot not found", r.path)
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	size := fi.Size()
+	if size < int64(len(Magic))+footerSize {
+		return nil, notFound
+	}
+	footer := make([]byte, footerSize)
+	if _, err = f.ReadAt(footer, size-footerSize); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	offset := int64(binary.LittleEndian.Uint64(footer))
+	if offset < int64(len(Magic)) || offset >= size-footerSize {
+		return nil, notFound
+	}
+
+	zr, err := gzip.NewReader(io.NewSectionReader(f, offset, size-footerSize-offset))
+	if err != nil {
+		return nil, notFound
+	}
+	snapshot := &Snapshot{}
+	if err = gob.NewDecoder(zr).Decode(snapshot); err != nil {
+		return nil, errors.Wrapf(err, "invalid trace file %s", r.path)
+	}
+	return snapshot, nil
+}
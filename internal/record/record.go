@@ -0,0 +1,103 @@
+// Package record persists the raw events of a tracing session into a trace
+// file, which can be replayed offline without the traced binary or root.
+//
+// A trace file is the magic followed by a gzip compressed gob stream of the
+// Header, then the raw events and args in the order they're received. The
+// Snapshot of the symbols and line info of the addresses in the events is
+// another gzip member after it, and the file ends with the offset of the
+// Snapshot, so it's read without decoding the events.
+package record
+
+import (
+	debugelf "debug/elf"
+	"fmt"
+	"time"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
+	"github.com/pkg/errors"
+)
+
+// Magic is the beginning of a trace file, the last byte is the format version
+const Magic = "GOFTRACE\x02"
+
+// footerSize is the size of the little endian offset of the Snapshot at the end
+const footerSize = 8
+
+// Header describes the tracing session of a trace file
+type Header struct {
+	Binary     string // path to the traced executable
+	GNUBuildID string // hex encoded, empty if not found
+	GoBuildID  string
+	Pid        int       // 0 if all processes of the executable are traced
+	LoadBias   uint64    // load bias of PIE executable
+	BootTime   time.Time // wall time when CLOCK_MONOTONIC is 0, see eventmanager.MonotonicEpoch
+	StartTime  time.Time
+	Uprobes    []uprobe.Uprobe
+	// MinDuration is the --min-duration of recording, replay uses it by default
+	MinDuration time.Duration
+}
+
+// Address is the symbol and line info of a link-time address
+type Address struct {
+	Symbols []string // names of the symbols at the same address
+	Offset  uint     // offset to the symbol
+	HasLine bool     // false if line info not found
+	File    string
+	Line    int
+}
+
+// Snapshot is the symbols and line info of the addresses in the events, it
+// resolves the addresses like elf.ELF when replaying.
+type Snapshot struct {
+	Addresses map[uint64]Address
+}
+
+// record is an item in the gob stream after the Header, only one field is set
+type record struct {
+	Event *bpf.GoftraceEvent
+	Arg   *bpf.GoftraceArgData
+}
+
+// ResolveAddress returns the symbols at `addr`, and the offset of addr to them
+func (s *Snapshot) ResolveAddress(addr uint64) (syms []debugelf.Symbol, offset uint, err error) {
+	a, ok := s.Addresses[addr]
+	if !ok || len(a.Symbols) == 0 {
+		err = errors.Wrap(elf.SymbolNotFoundError, fmt.Sprintf("%x", addr))
+		return
+	}
+	for _, name := range a.Symbols {
+		syms = append(syms, debugelf.Symbol{Name: name, Value: addr - uint64(a.Offset)})
+	}
+	return syms, a.Offset, nil
+}
+
+// LineInfoForPc returns the filename and line number of `pc`
+func (s *Snapshot) LineInfoForPc(pc uint64) (filename string, line int, err error) {
+	a, ok := s.Addresses[pc]
+	if !ok || !a.HasLine {
+		err = errors.Wrapf(elf.SymbolNotFoundError, "line info of %x", pc)
+		return
+	}
+	return a.File, a.Line, nil
+}
+
+// snapshot resolves the link-time addresses `addrs` by ELF file `e`
+func snapshot(e *elf.ELF, addrs map[uint64]struct{}) *Snapshot {
+	s := &Snapshot{Addresses: make(map[uint64]Address, len(addrs))}
+	for addr := range addrs {
+		a := Address{}
+		if syms, offset, err := e.ResolveAddress(addr); err == nil {
+			for _, sym := range syms {
+				a.Symbols = append(a.Symbols, sym.Name)
+			}
+			a.Offset = offset
+		}
+		if filename, line, err := e.LineInfoForPc(addr); err == nil {
+			a.HasLine, a.File, a.Line = true, filename, line
+		}
+		s.Addresses[addr] = a
+	}
+	return s
+}
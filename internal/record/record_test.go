@@ -0,0 +1,123 @@
+package record
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/hitzhangjie/go-ftrace/internal/uprobe"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RecordReplay(t *testing.T) {
+	e, err := elf.New(os.Args[0], "")
+	require.Nil(t, err)
+	sym, err := e.ResolveSymbol("github.com/hitzhangjie/go-ftrace/internal/record.snapshot")
+	require.Nil(t, err)
+
+	const loadBias = 0x1000
+	path := filepath.Join(t.TempDir(), "trace.ftr")
+	header := &Header{
+		Binary:    os.Args[0],
+		LoadBias:  loadBias,
+		BootTime:  time.Unix(1700000000, 0),
+		StartTime: time.Unix(1700000100, 0),
+		Uprobes:   []uprobe.Uprobe{{Funcname: sym.Name, Address: sym.Value, Location: uprobe.AtEntry}},
+	}
+	w, err := Create(path, header, e)
+	require.Nil(t, err)
+	argCh := make(chan bpf.GoftraceArgData, 1)
+	w.WriteArgs(argCh)
+	argCh <- bpf.GoftraceArgData{Goid: 1, Data: [64]uint8{42}}
+	close(argCh)
+	require.Nil(t, w.WriteEvent(bpf.GoftraceEvent{Goid: 1, Ip: sym.Value + loadBias, TimeNs: 100}))
+	require.Nil(t, w.WriteEvent(bpf.GoftraceEvent{Goid: 1, Ip: sym.Value + 4 + loadBias, TimeNs: 200, Location: 1}))
+	require.Nil(t, w.Close())
+
+	r, err := Open(path)
+	require.Nil(t, err)
+	require.Equal(t, header.Binary, r.Header.Binary)
+	require.Equal(t, header.Uprobes, r.Header.Uprobes)
+	require.True(t, header.BootTime.Equal(r.Header.BootTime))
+
+	// args and events are split from the records decoded once
+	argsDone := make(chan []bpf.GoftraceArgData)
+	go func() {
+		args := []bpf.GoftraceArgData{}
+		for arg := range r.Args() {
+			args = append(args, arg)
+		}
+		argsDone <- args
+	}()
+	events := []bpf.GoftraceEvent{}
+	require.Nil(t, r.Events(func(event bpf.GoftraceEvent) error {
+		events = append(events, event)
+		return nil
+	}))
+	args := <-argsDone
+	require.Len(t, args, 1)
+	require.Equal(t, uint8(42), args[0].Data[0])
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(200), events[1].TimeNs)
+
+	// addresses are resolved at link time, like elf.ELF
+	for _, addr := range []uint64{sym.Value, sym.Value + 4} {
+		wantSyms, wantOffset, err := e.ResolveAddress(addr)
+		require.Nil(t, err)
+		syms, offset, err := r.Snapshot.ResolveAddress(addr)
+		require.Nil(t, err)
+		require.Equal(t, wantSyms[0].Name, syms[0].Name)
+		require.Equal(t, wantOffset, offset)
+
+		wantFile, wantLine, err := e.LineInfoForPc(addr)
+		require.Nil(t, err)
+		file, line, err := r.Snapshot.LineInfoForPc(addr)
+		require.Nil(t, err)
+		require.Equal(t, wantFile, file)
+		require.Equal(t, wantLine, line)
+	}
+	_, _, err = r.Snapshot.ResolveAddress(sym.Value + 8)
+	require.NotNil(t, err)
+}
+
+func Test_ReplayStop(t *testing.T) {
+	e, err := elf.New(os.Args[0], "")
+	require.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "trace.ftr")
+	w, err := Create(path, &Header{Binary: os.Args[0]}, e)
+	require.Nil(t, err)
+	for i := 0; i < 3*eventBuffer; i++ {
+		require.Nil(t, w.WriteArg(bpf.GoftraceArgData{Goid: uint64(i)}))
+		require.Nil(t, w.WriteEvent(bpf.GoftraceEvent{Goid: uint64(i)}))
+	}
+	require.Nil(t, w.Close())
+
+	// decoding stops with the handler, and Args is closed
+	r, err := Open(path)
+	require.Nil(t, err)
+	go func() {
+		for range r.Args() {
+		}
+	}()
+	stop := errors.New("stop")
+	events := 0
+	require.Equal(t, stop, r.Events(func(event bpf.GoftraceEvent) error {
+		if events++; events == 10 {
+			return stop
+		}
+		return nil
+	}))
+	_, ok := <-r.Args()
+	require.False(t, ok)
+
+	// the Snapshot is missing if the recording is killed before closed
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, data[:len(data)/2], 0644))
+	_, err = Open(path)
+	require.ErrorContains(t, err, "symbol snapshot not found")
+}
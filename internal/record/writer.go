@@ -0,0 +1,142 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"os"
+	"sync"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+	"github.com/hitzhangjie/go-ftrace/internal/bpf"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Writer writes the events of a tracing session into a trace file
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	cw  *countWriter
+	bw  *bufio.Writer
+	zw  *gzip.Writer
+	enc *gob.Encoder
+
+	elf      *elf.ELF
+	loadBias uint64
+	addrs    map[uint64]struct{} // link-time addresses in the events
+	argsDone chan struct{}
+}
+
+// Create creates the trace file `path` with `header`, the addresses in the
+// events are resolved by `e` when it's closed.
+func Create(path string, header *Header, e *elf.ELF) (_ *Writer, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	w := &Writer{
+		f:        f,
+		cw:       &countWriter{w: f},
+		elf:      e,
+		loadBias: header.LoadBias,
+		addrs:    map[uint64]struct{}{},
+	}
+	w.bw = bufio.NewWriter(w.cw)
+	w.zw = gzip.NewWriter(w.bw)
+	w.enc = gob.NewEncoder(w.zw)
+
+	if _, err = w.bw.WriteString(Magic); err == nil {
+		err = w.enc.Encode(header)
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	return w, nil
+}
+
+// WriteEvent writes an entry/return event
+func (w *Writer) WriteEvent(event bpf.GoftraceEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.addrs[event.Ip-w.loadBias] = struct{}{}
+	if event.CallerIp != 0 {
+		w.addrs[event.CallerIp-w.loadBias] = struct{}{}
+	}
+	return errors.WithStack(w.enc.Encode(&record{Event: &event}))
+}
+
+// WriteArg writes a fetched argument
+func (w *Writer) WriteArg(arg bpf.GoftraceArgData) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.WithStack(w.enc.Encode(&record{Arg: &arg}))
+}
+
+// WriteArgs writes the fetched arguments received from `ch` in background,
+// until `ch` is closed.
+func (w *Writer) WriteArgs(ch <-chan bpf.GoftraceArgData) {
+	w.argsDone = make(chan struct{})
+	go func() {
+		defer close(w.argsDone)
+		for arg := range ch {
+			// keep draining on error, the poller blocks otherwise
+			if err := w.WriteArg(arg); err != nil {
+				log.Errorf("failed to record arg %+v: %v", arg, err)
+			}
+		}
+	}()
+}
+
+// Close waits for the fetched arguments written, then writes the Snapshot
+// and its offset, and closes the trace file.
+func (w *Writer) Close() (err error) {
+	if w.argsDone != nil {
+		<-w.argsDone
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err = w.zw.Close(); err == nil {
+		err = w.bw.Flush()
+	}
+	if err == nil {
+		err = w.writeSnapshot()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.WithStack(err)
+}
+
+// writeSnapshot writes the Snapshot as a new gzip member, and the footer
+func (w *Writer) writeSnapshot() (err error) {
+	offset := w.cw.n
+	zw := gzip.NewWriter(w.bw)
+	if err = gob.NewEncoder(zw).Encode(snapshot(w.elf, w.addrs)); err != nil {
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer, uint64(offset))
+	if _, err = w.bw.Write(footer); err != nil {
+		return
+	}
+	return w.bw.Flush()
+}
+
+// countWriter counts the bytes written to the trace file
+type countWriter struct {
+	w *os.File
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
@@ -0,0 +1,291 @@
+// Package tui browses the traced call trees in an interactive terminal UI.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxRoots is the number of root calls kept, the oldest are dropped
+	maxRoots = 10000
+	// refreshInterval is the interval to show the new root calls
+	refreshInterval = 200 * time.Millisecond
+)
+
+// sort orders of the root calls
+const (
+	byTime = iota
+	byDuration
+)
+
+// root is a completed root call shown in the list
+type root struct {
+	call  *eventmanager.Call
+	calls int    // number of calls in the tree
+	text  string // lower-cased functions and args in the tree, for searching
+}
+
+func newRoot(call *eventmanager.Call) *root {
+	r := &root{call: call}
+	sb := &strings.Builder{}
+	call.Walk(func(c *eventmanager.Call, depth int) error {
+		r.calls++
+		fmt.Fprintf(sb, "%s(%s)\n", c.Function, c.ArgString())
+		return nil
+	}, nil)
+	r.text = strings.ToLower(sb.String())
+	return r
+}
+
+// UI lists the completed root calls, sortable by duration and searchable by
+// the functions and args in them, each can be expanded into its call tree.
+//
+// It's an eventmanager.Output, the call trees are written into it instead
+// of printed.
+type UI struct {
+	app    *tview.Application
+	table  *tview.Table
+	tree   *tview.TreeView
+	search *tview.InputField
+	status *tview.TextView
+
+	mu      sync.Mutex
+	pending []*eventmanager.Call // written but not shown yet
+	stopped bool                 // tracing stopped
+	changed bool                 // pending or stopped changed since refreshed
+
+	// accessed in the event loop of app only
+	roots  []*root
+	shown  []*root // filtered and sorted
+	sortBy int
+	filter string
+
+	started bool
+	logOut  io.Writer
+	done    chan struct{}
+	err     error
+}
+
+// New creates the UI, it's drawn after Start called
+func New() *UI {
+	u := &UI{
+		app:    tview.NewApplication(),
+		table:  tview.NewTable(),
+		tree:   tview.NewTreeView(),
+		search: tview.NewInputField(),
+		status: tview.NewTextView(),
+		done:   make(chan struct{}),
+	}
+
+	u.search.SetLabel("search: ").
+		SetFieldBackgroundColor(tcell.ColorDefault).
+		SetChangedFunc(func(text string) {
+			u.filter = strings.ToLower(strings.TrimSpace(text))
+			u.refresh()
+		}).
+		SetDoneFunc(func(key tcell.Key) {
+			u.app.SetFocus(u.table)
+		})
+
+	u.table.SetSelectable(true, false).
+		SetFixed(1, 0).
+		SetSelectedFunc(func(row, column int) {
+			if row > 0 && row <= len(u.shown) {
+				u.showTree(u.shown[row-1])
+				u.app.SetFocus(u.tree)
+			}
+		}).
+		SetSelectionChangedFunc(func(row, column int) {
+			if row > 0 && row <= len(u.shown) {
+				u.showTree(u.shown[row-1])
+			}
+		})
+	u.table.SetBorder(true).SetTitle(" root calls ")
+
+	u.tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		node.SetExpanded(!node.IsExpanded())
+	}).
+		SetDoneFunc(func(key tcell.Key) {
+			u.app.SetFocus(u.table)
+		})
+	u.tree.SetBorder(true).SetTitle(" call tree ")
+
+	u.status.SetDynamicColors(true)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(u.search, 1, 0, false).
+		AddItem(u.table, 0, 1, true).
+		AddItem(u.tree, 0, 2, false).
+		AddItem(u.status, 1, 0, false)
+	u.app.SetRoot(layout, true).SetInputCapture(u.handleKey)
+	u.refresh()
+	return u
+}
+
+// handleKey handles the global keys, except when typing the search
+func (u *UI) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if u.app.GetFocus() == u.search {
+		return event
+	}
+	switch {
+	case event.Key() == tcell.KeyTab:
+		if u.app.GetFocus() == u.table {
+			u.app.SetFocus(u.tree)
+		} else {
+			u.app.SetFocus(u.table)
+		}
+		return nil
+	case event.Rune() == '/':
+		u.app.SetFocus(u.search)
+		return nil
+	case event.Rune() == 's':
+		u.sortBy = (u.sortBy + 1) % 2
+		u.refresh()
+		return nil
+	case event.Rune() == 'q':
+		u.app.Stop()
+		return nil
+	}
+	return event
+}
+
+// Start draws the UI in the terminal in background, the logs are discarded
+// until the UI quits, they mess up the screen.
+func (u *UI) Start() {
+	u.started = true
+	u.logOut = log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+
+	go func() {
+		defer close(u.done)
+		u.err = u.app.Run()
+		log.SetOutput(u.logOut)
+	}()
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-u.done:
+				return
+			case <-ticker.C:
+				u.mu.Lock()
+				changed := u.changed
+				u.mu.Unlock()
+				if changed {
+					u.app.QueueUpdateDraw(u.refresh)
+				}
+			}
+		}
+	}()
+}
+
+// Done returns a channel that's closed when the user quits the UI
+func (u *UI) Done() <-chan struct{} {
+	return u.done
+}
+
+// Write adds the completed root call, it never blocks the tracing
+func (u *UI) Write(call *eventmanager.Call) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending = append(u.pending, call)
+	u.changed = true
+	return nil
+}
+
+// Close waits for the user to quit the UI after tracing stopped
+func (u *UI) Close() error {
+	if !u.started {
+		return nil
+	}
+	u.mu.Lock()
+	u.stopped, u.changed = true, true
+	u.mu.Unlock()
+	select {
+	case <-u.done:
+	default:
+		// repaint the screen, detaching uprobes may print to the terminal
+		u.app.Sync()
+		<-u.done
+	}
+	return u.err
+}
+
+// refresh shows the new root calls, and applies the filter and sort order
+func (u *UI) refresh() {
+	u.mu.Lock()
+	pending, stopped := u.pending, u.stopped
+	u.pending, u.changed = nil, false
+	u.mu.Unlock()
+
+	for _, call := range pending {
+		u.roots = append(u.roots, newRoot(call))
+	}
+	if len(u.roots) > maxRoots {
+		u.roots = u.roots[len(u.roots)-maxRoots:]
+	}
+
+	u.shown = u.shown[:0]
+	for _, r := range u.roots {
+		if u.filter == "" || strings.Contains(r.text, u.filter) {
+			u.shown = append(u.shown, r)
+		}
+	}
+	sortName := "time"
+	if u.sortBy == byDuration {
+		sortName = "duration"
+		sort.SliceStable(u.shown, func(i, j int) bool {
+			return u.shown[i].call.Duration() > u.shown[j].call.Duration()
+		})
+	}
+
+	u.table.Clear()
+	for col, title := range []string{"TIME", "GOID", "DURATION", "CALLS", "FUNCTION"} {
+		u.table.SetCell(0, col, tview.NewTableCell(title).SetSelectable(false).SetTextColor(tcell.ColorYellow))
+	}
+	for i, r := range u.shown {
+		u.table.SetCell(i+1, 0, tview.NewTableCell(r.call.Start.Format("15:04:05.000000")))
+		u.table.SetCell(i+1, 1, tview.NewTableCell(fmt.Sprint(r.call.Goid)).SetAlign(tview.AlignRight))
+		u.table.SetCell(i+1, 2, tview.NewTableCell(r.call.Duration().String()).SetAlign(tview.AlignRight))
+		u.table.SetCell(i+1, 3, tview.NewTableCell(fmt.Sprint(r.calls)).SetAlign(tview.AlignRight))
+		u.table.SetCell(i+1, 4, tview.NewTableCell(tview.Escape(r.call.Function)).SetExpansion(1))
+	}
+
+	state := "[green]tracing[-]"
+	if stopped {
+		state = "[red]stopped[-]"
+	}
+	u.status.SetText(fmt.Sprintf("%s | %d root calls, %d shown, sorted by %s | enter: expand  s: sort  /: search  tab: switch  q: quit",
+		state, len(u.roots), len(u.shown), sortName))
+}
+
+// showTree shows the call tree of root call `r`
+func (u *UI) showTree(r *root) {
+	var build func(call *eventmanager.Call) *tview.TreeNode
+	build = func(call *eventmanager.Call) *tview.TreeNode {
+		duration := "[red]not returned[-]"
+		if call.Returned {
+			duration = call.Duration().String()
+		}
+		node := tview.NewTreeNode(fmt.Sprintf("[red]%s[-]([fuchsia]%s[-]) %s [darkcyan]%s[-]",
+			tview.Escape(call.Function), tview.Escape(call.ArgString()), duration, tview.Escape(call.CallSite))).
+			SetReference(call)
+		for _, child := range call.Children {
+			node.AddChild(build(child))
+		}
+		return node
+	}
+	node := build(r.call)
+	u.tree.SetRoot(node).SetCurrentNode(node)
+}
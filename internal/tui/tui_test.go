@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hitzhangjie/go-ftrace/internal/eventmanager"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRoot(function string, start time.Time, d time.Duration, args ...eventmanager.Arg) *eventmanager.Call {
+	ns := uint64(start.UnixNano())
+	root := &eventmanager.Call{Goid: 1, Function: function, Start: start, StartNs: ns,
+		Returned: true, End: start.Add(d), EndNs: ns + uint64(d)}
+	root.Children = []*eventmanager.Call{{Goid: 1, Function: "main.add", Args: args, Start: start, StartNs: ns,
+		Returned: true, End: start.Add(d / 2), EndNs: ns + uint64(d/2), Parent: root}}
+	return root
+}
+
+func Test_UIFilterAndSort(t *testing.T) {
+	start := time.Date(2023, 12, 23, 17, 11, 0, 0, time.UTC)
+	u := New()
+	require.Nil(t, u.Write(newTestRoot("main.fast", start, time.Millisecond)))
+	require.Nil(t, u.Write(newTestRoot("main.slow", start.Add(time.Second), time.Second, eventmanager.Arg{Name: "a", Value: "Bob"})))
+	u.refresh()
+	require.Len(t, u.shown, 2)
+	require.Equal(t, "main.fast", u.shown[0].call.Function)
+	require.Equal(t, 2, u.shown[0].calls)
+	require.Equal(t, 3, u.table.GetRowCount())
+
+	u.sortBy = byDuration
+	u.refresh()
+	require.Equal(t, "main.slow", u.shown[0].call.Function)
+
+	// matches the args of the children, case-insensitive
+	u.search.SetText("bOB")
+	require.Len(t, u.shown, 1)
+	require.Equal(t, "main.slow", u.shown[0].call.Function)
+
+	u.showTree(u.shown[0])
+	require.Len(t, u.tree.GetRoot().GetChildren(), 1)
+
+	require.Nil(t, u.Close()) // not started
+}
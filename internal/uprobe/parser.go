@@ -5,6 +5,7 @@ import (
 	debugelf "debug/elf"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hitzhangjie/go-ftrace/elf"
@@ -14,63 +15,125 @@ import (
 type ParseOptions struct {
 	ExcludeVendor   bool
 	UprobeWildcards []string
+	Excludes        []string // wildcards of functions excluded from UprobeWildcards, but not from FuncNames
 	FuncNames       []string
 	FetchFuncArgs   map[string]map[string]string // funcname: varname: expression
+	FuncPredicates  map[string]string            // funcname: condition on the fetched args, like: req.id == 42
 }
 
-// Parse parses the wanted function names (and its parameters), and parse DWARF info, ELF info
-// to determine the addresses of all wanted functions' entry and (multiple) return instruction,
-// then build the uprobes that will be attached.
-func Parse(elf *elf.ELF, opts *ParseOptions) (uprobes []Uprobe, err error) {
-	fetchArgs, err := parseFetchArgs(opts.FetchFuncArgs)
+// Selection describes a function matching the wildcards, and whether it's selected to trace
+type Selection struct {
+	Funcname   string
+	Wildcard   string   // the wildcard which matches the function
+	Address    uint64   // absolute address of the function entry
+	EntOffset  uint64   // offset of the function entry to the ELF file beginning
+	RetOffsets []uint64 // offsets of the RET instructions to the ELF file beginning
+	Wanted     bool     // whether the function starts a trace
+	SkipReason string   // why the function is skipped, empty if it's selected
+	ExcludedBy string   // the exclude wildcard which excludes the function
+}
+
+// SkipVendor is the SkipReason of functions excluded as vendor code
+const SkipVendor = "vendor excluded"
+
+// SkipExcluded is the SkipReason of functions excluded by ParseOptions.Excludes
+const SkipExcluded = "excluded"
+
+// Select selects the functions matching the wildcards, and determines the addresses of their
+// entry and (multiple) return instructions. Functions which can't be traced are also returned,
+// with `SkipReason` specified.
+func Select(elf *elf.ELF, opts *ParseOptions) (selections []Selection, err error) {
+	symbols, _, err := elf.Symbols()
 	if err != nil {
 		return
 	}
 
-	symbols, _, err := elf.Symbols()
+	selectors, err := ParseSelectors(append(append([]string{}, opts.UprobeWildcards...), opts.FuncNames...))
+	if err != nil {
+		return
+	}
+	excludes, err := ParseSelectors(opts.Excludes)
+	if err != nil {
+		return
+	}
+	wanted, err := ParseSelectors(opts.FuncNames)
 	if err != nil {
 		return
 	}
 
-	wantedFuncs := map[string]interface{}{}
-	attachFuncs := []string{}
-
-	funcs := append(opts.UprobeWildcards, opts.FuncNames...)
 	for _, symbol := range symbols {
 		if debugelf.ST_TYPE(symbol.Info) != debugelf.STT_FUNC {
 			continue
 		}
-		for _, fn := range funcs {
-			if !MatchWildcard(fn, symbol.Name) {
+		for _, selector := range selectors {
+			if !selector.Match(elf, symbol.Name) {
 				continue
 			}
+			selection := Selection{
+				Funcname: symbol.Name,
+				Wildcard: selector.Spec,
+				Address:  symbol.Value,
+			}
+			if selection.EntOffset, err = elf.FuncOffset(symbol.Name); err != nil {
+				return nil, err
+			}
 			if opts.ExcludeVendor && strings.Contains(symbol.Name, "/vendor/") {
-				continue
+				selection.SkipReason = SkipVendor
+				selections = append(selections, selection)
+				break
+			}
+			// the functions to fetch are specified explicitly, they're never excluded
+			if exclude := matchAny(excludes, elf, symbol.Name); exclude != nil && matchAny(wanted, elf, symbol.Name) == nil {
+				selection.SkipReason = SkipExcluded
+				selection.ExcludedBy = exclude.Spec
+				selections = append(selections, selection)
+				break
 			}
-			// record the function name that will be traced
-			attachFuncs = append(attachFuncs, symbol.Name)
 			// record the function arguments that will be traced
-			if len(opts.FuncNames) == 0 {
-				wantedFuncs[symbol.Name] = true
-			} else {
-				for _, fn := range opts.FuncNames {
-					if MatchWildcard(fn, symbol.Name) {
-						wantedFuncs[symbol.Name] = true
-						break
-					}
-				}
+			selection.Wanted = len(wanted) == 0 || matchAny(wanted, elf, symbol.Name) != nil
+			// function may have multiple return statements
+			retOffsets, err := elf.FuncRetOffsets(symbol.Name)
+			if err == nil && len(retOffsets) == 0 {
+				err = errors.New("no ret offsets")
+			}
+			if err != nil {
+				selection.SkipReason = err.Error()
 			}
+			selection.RetOffsets = retOffsets
+			selections = append(selections, selection)
 			break
 		}
 	}
+	return selections, nil
+}
+
+// Parse parses the wanted function names (and its parameters), and parse DWARF info, ELF info
+// to determine the addresses of all wanted functions' entry and (multiple) return instruction,
+// then build the uprobes that will be attached.
+//
+// `excluded` is the number of functions matching the wildcards but excluded by opts.Excludes.
+func Parse(elf *elf.ELF, opts *ParseOptions) (uprobes []Uprobe, excluded int, err error) {
+	fetchArgs, err := parseFetchArgs(opts.FetchFuncArgs)
+	if err != nil {
+		return
+	}
+	predicates, err := parseFuncPredicates(opts.FuncPredicates, fetchArgs)
+	if err != nil {
+		return
+	}
+
+	selections, err := Select(elf, opts)
+	if err != nil {
+		return
+	}
 
 	sym, err := elf.ResolveSymbol("runtime.goexit1")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	entOffset, err := elf.FuncOffset("runtime.goexit1")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	uprobes = append(uprobes, Uprobe{
 		Funcname:  "runtime.goexit1",
@@ -79,55 +142,52 @@ func Parse(elf *elf.ELF, opts *ParseOptions) (uprobes []Uprobe, err error) {
 		AbsOffset: entOffset,
 	})
 
-	for _, funcname := range attachFuncs {
-		message := &bytes.Buffer{}
-		fmt.Fprintf(message, "add uprobes for %s: ", funcname)
-
-		sym, err := elf.ResolveSymbol(funcname)
-		if err != nil {
-			return nil, err
+	for _, selection := range selections {
+		funcname := selection.Funcname
+		switch selection.SkipReason {
+		case "":
+		case SkipVendor:
+			continue
+		case SkipExcluded:
+			log.Debugf("skip %s, excluded by %s", funcname, selection.ExcludedBy)
+			excluded++
+			continue
+		default:
+			log.Warnf("skip %s, failed to get ret offsets: %v", funcname, selection.SkipReason)
+			continue
 		}
 
-		entOffset, err := elf.FuncOffset(funcname)
-		if err != nil {
-			return nil, err
-		}
-		_, wanted := wantedFuncs[funcname]
-		fmt.Fprintf(message, "0x%x -> ", entOffset)
+		message := &bytes.Buffer{}
+		fmt.Fprintf(message, "add uprobes for %s: ", funcname)
+		fmt.Fprintf(message, "0x%x -> ", selection.EntOffset)
 
 		// uprobes for function entry
 		uprobes = append(uprobes, Uprobe{
-			Funcname:  funcname,
-			Location:  AtEntry,
-			Address:   sym.Value,
-			AbsOffset: entOffset,
-			RelOffset: 0,
-			FetchArgs: fetchArgs[funcname],
-			Wanted:    wanted,
+			Funcname:   funcname,
+			Location:   AtEntry,
+			Address:    selection.Address,
+			AbsOffset:  selection.EntOffset,
+			RelOffset:  0,
+			FetchArgs:  fetchArgs[funcname],
+			Predicates: predicates[funcname],
+			Wanted:     selection.Wanted,
+			Wildcard:   selection.Wildcard,
 		})
 
 		// uprobes for function return (may have multiple return statements)
-		retOffsets, err := elf.FuncRetOffsets(funcname)
-		if err == nil && len(retOffsets) == 0 {
-			err = errors.New("no ret offsets")
-		}
-		if err != nil {
-			log.Warnf("skip %s, failed to get ret offsets: %v", funcname, err)
-			uprobes = uprobes[:len(uprobes)-1]
-			continue
-		}
 		fmt.Fprintf(message, "[ ")
-		for _, retOffset := range retOffsets {
+		for _, retOffset := range selection.RetOffsets {
 			fmt.Fprintf(message, "0x%x ", retOffset)
 			uprobes = append(uprobes, Uprobe{
 				Funcname:  funcname,
 				Location:  AtRet,
 				AbsOffset: retOffset,
-				RelOffset: retOffset - entOffset,
+				RelOffset: retOffset - selection.EntOffset,
+				Wildcard:  selection.Wildcard,
 			})
 		}
 		fmt.Fprintf(message, "]")
-		if wanted {
+		if selection.Wanted {
 			fmt.Fprintf(message, " *")
 		}
 		fmt.Fprintf(message, "\n")
@@ -135,3 +195,33 @@ func Parse(elf *elf.ELF, opts *ParseOptions) (uprobes []Uprobe, err error) {
 	}
 	return
 }
+
+// WildcardCount is the number of uprobes contributed by a wildcard
+type WildcardCount struct {
+	Wildcard string
+	Count    int
+}
+
+// TopWildcards returns the top `n` wildcards contributing the most uprobes
+func TopWildcards(uprobes []Uprobe, n int) (counts []WildcardCount) {
+	m := map[string]int{}
+	for _, up := range uprobes {
+		if up.Wildcard == "" {
+			continue
+		}
+		m[up.Wildcard]++
+	}
+	for wildcard, count := range m {
+		counts = append(counts, WildcardCount{wildcard, count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Wildcard < counts[j].Wildcard
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return
+}
@@ -0,0 +1,46 @@
+package uprobe
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TopWildcards(t *testing.T) {
+	uprobes := []Uprobe{
+		{Funcname: "runtime.goexit1", Location: AtGoroutineExit},
+		{Funcname: "main.add", Location: AtEntry, Wildcard: "main.*"},
+		{Funcname: "main.add", Location: AtRet, Wildcard: "main.*"},
+		{Funcname: "fmt.Println", Location: AtEntry, Wildcard: "fmt.Print*"},
+		{Funcname: "main.minus", Location: AtEntry, Wildcard: "main.*"},
+	}
+
+	counts := TopWildcards(uprobes, 10)
+	require.Equal(t, []WildcardCount{{"main.*", 3}, {"fmt.Print*", 1}}, counts)
+
+	counts = TopWildcards(uprobes, 1)
+	require.Equal(t, []WildcardCount{{"main.*", 3}}, counts)
+}
+
+func Test_SelectExcludes(t *testing.T) {
+	e, err := elf.New(os.Args[0], "")
+	require.Nil(t, err)
+
+	const pkg = "github.com/hitzhangjie/go-ftrace/internal/uprobe."
+	selections, err := Select(e, &ParseOptions{
+		UprobeWildcards: []string{pkg + "Test_*"},
+		Excludes:        []string{"*FetchArg*"},
+		FuncNames:       []string{pkg + "Test_NewFetchArg2"},
+	})
+	require.Nil(t, err)
+
+	reasons := map[string]string{}
+	for _, s := range selections {
+		reasons[s.Funcname] = s.SkipReason + s.ExcludedBy
+	}
+	require.Equal(t, SkipExcluded+"*FetchArg*", reasons[pkg+"Test_NewFetchArg"])
+	require.Equal(t, "", reasons[pkg+"Test_NewFetchArg2"]) // fetched explicitly
+	require.Equal(t, "", reasons[pkg+"Test_SelectExcludes"])
+}
@@ -0,0 +1,189 @@
+package uprobe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PredicateOp is the comparison operator of a Predicate
+type PredicateOp uint8
+
+const (
+	OpEQ PredicateOp = iota
+	OpNE
+	OpLT
+	OpLE
+	OpGT
+	OpGE
+	OpPrefix // the string starts with
+)
+
+// predicateOps are the operators indexed by PredicateOp
+var predicateOps = []string{"==", "!=", "<", "<=", ">", ">=", "^="}
+
+func (op PredicateOp) String() string {
+	return predicateOps[op]
+}
+
+// Predicate is a condition on a fetched arg, like: req.id == 42, s.name == "bob".
+// It's evaluated in the BPF programme when the function is called, only the
+// calls matching all predicates of the function start a trace.
+//
+// An integer arg is compared with Value, as signed if its type is s8...s64.
+// A c8...c512 arg is compared with Data by ==, != or ^= only. == and !=
+// compare its length arg too, which must be fetched as <name>.len, like:
+// s.name == "bob" with s.name and s.name.len fetched, and ^= matches the
+// prefix: s.name ^= "bo".
+type Predicate struct {
+	Statement string // like: req.id == 42
+	Arg       int    // index of the arg in Uprobe.FetchArgs
+	Op        PredicateOp
+	Value     uint64 // integer to compare, int64 is stored as its bits
+	Data      []byte // bytes to compare, for c8...c512 args
+	LenArg    int    // index of the length arg of a c8...c512 arg compared by == or !=, -1 if none
+}
+
+// parseFuncPredicates parses the conditions of the functions, the args in
+// them must be fetched, see parseFetchArgs.
+func parseFuncPredicates(funcConds map[string]string, fetchArgs map[string][]*FetchArg) (predicates map[string][]*Predicate, err error) {
+	predicates = map[string][]*Predicate{}
+	for fname, cond := range funcConds {
+		if predicates[fname], err = parsePredicates(cond, fetchArgs[fname]); err != nil {
+			return nil, fmt.Errorf("invalid condition of %s: %w", fname, err)
+		}
+	}
+	return
+}
+
+// parsePredicates parses the condition `cond`, which is predicates joined by
+// &&, like: s.name == "bob" && s.age >= 18
+func parsePredicates(cond string, fetchArgs []*FetchArg) (predicates []*Predicate, err error) {
+	for _, stmt := range splitOutsideQuotes(cond, "&&") {
+		p, err := newPredicate(strings.TrimSpace(stmt), fetchArgs)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+	return
+}
+
+// newPredicate parses a predicate like: req.id == 42
+func newPredicate(stmt string, fetchArgs []*FetchArg) (_ *Predicate, err error) {
+	var (
+		op          PredicateOp
+		left, right string
+		found       bool
+	)
+	inQuote := false
+	for i := 0; i < len(stmt) && !found; i++ {
+		switch {
+		case stmt[i] == '\\' && inQuote:
+			i++
+		case stmt[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.ContainsRune("=!<>^", rune(stmt[i])):
+			found = true
+			if i+1 < len(stmt) && stmt[i+1] == '=' {
+				op, left, right = PredicateOp(indexOf(predicateOps, stmt[i:i+2])), stmt[:i], stmt[i+2:]
+			} else if stmt[i] == '<' || stmt[i] == '>' {
+				op, left, right = PredicateOp(indexOf(predicateOps, stmt[i:i+1])), stmt[:i], stmt[i+1:]
+			} else {
+				return nil, fmt.Errorf("unknown operator in predicate: %s", stmt)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("operator not found in predicate: %s, want ==, !=, <, <=, >, >= or ^=", stmt)
+	}
+	varname, literal := strings.TrimSpace(left), strings.TrimSpace(right)
+
+	p := &Predicate{Statement: stmt, Arg: fetchArgIndex(fetchArgs, varname), Op: op, LenArg: -1}
+	if p.Arg < 0 {
+		return nil, fmt.Errorf("arg %s in predicate is not fetched: %s", varname, stmt)
+	}
+	arg := fetchArgs[p.Arg]
+	if op == OpPrefix && arg.Type[0] != 'c' {
+		return nil, fmt.Errorf("^= is only supported for c8...c512: %s", stmt)
+	}
+
+	switch arg.Type[0] {
+	case 'c':
+		if !strings.HasPrefix(literal, `"`) {
+			return nil, fmt.Errorf("%s is %s, want a quoted string: %s", varname, arg.Type, stmt)
+		}
+		s, err := strconv.Unquote(literal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s: %s", literal, stmt)
+		}
+		switch op {
+		case OpEQ, OpNE:
+			// the bytes after the string are not the string, compare its length too
+			p.LenArg = fetchArgIndex(fetchArgs, varname+".len")
+			if p.LenArg < 0 || !strings.ContainsAny(fetchArgs[p.LenArg].Type[:1], "us") {
+				return nil, fmt.Errorf("%s compares the length too, fetch %s.len as an integer, or use ^= to match the prefix: %s", op, varname, stmt)
+			}
+			if len(s) > arg.Size {
+				return nil, fmt.Errorf("string length must be in [0, %d] for %s: %s", arg.Size, arg.Type, stmt)
+			}
+		case OpPrefix:
+			if len(s) == 0 || len(s) > arg.Size {
+				return nil, fmt.Errorf("string length must be in [1, %d] for %s: %s", arg.Size, arg.Type, stmt)
+			}
+		default:
+			return nil, fmt.Errorf("only ==, != and ^= are supported for %s: %s", arg.Type, stmt)
+		}
+		p.Data = []byte(s)
+	case 'u':
+		if p.Value, err = strconv.ParseUint(literal, 0, arg.Size*8); err != nil {
+			return nil, fmt.Errorf("%s is %s, invalid value %s: %s", varname, arg.Type, literal, stmt)
+		}
+	case 's':
+		v, err := strconv.ParseInt(literal, 0, arg.Size*8)
+		if err != nil {
+			return nil, fmt.Errorf("%s is %s, invalid value %s: %s", varname, arg.Type, literal, stmt)
+		}
+		p.Value = uint64(v)
+	default:
+		return nil, fmt.Errorf("predicate on %s is not supported: %s", arg.Type, stmt)
+	}
+	return p, nil
+}
+
+// splitOutsideQuotes splits `s` by `sep` which is not in double quotes
+func splitOutsideQuotes(s, sep string) (parts []string) {
+	inQuote, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuote:
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			start = i + len(sep)
+			i += len(sep) - 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// fetchArgIndex returns the index of arg `varname` in `fetchArgs`, -1 if not fetched
+func fetchArgIndex(fetchArgs []*FetchArg, varname string) int {
+	for i, arg := range fetchArgs {
+		if arg.Varname == varname {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,73 @@
+package uprobe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParsePredicates(t *testing.T) {
+	args := []*FetchArg{}
+	for name, stmt := range map[string]string{
+		"s.name":     "(*+0(%ax)):c64",
+		"s.name.len": "(+8(%ax)):s64",
+		"req.id":     "(+8(%bx)):u32",
+	} {
+		arg, err := newFetchArg(name, stmt)
+		require.Nil(t, err)
+		args = append(args, arg)
+	}
+	argIndex := func(name string) int {
+		for i, arg := range args {
+			if arg.Varname == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	predicates, err := parsePredicates(`s.name == "a&&b" && s.name.len>=-1&&req.id != 0x2a`, args)
+	require.Nil(t, err)
+	require.Len(t, predicates, 3)
+	require.Equal(t, argIndex("s.name"), predicates[0].Arg)
+	require.Equal(t, OpEQ, predicates[0].Op)
+	require.Equal(t, []byte("a&&b"), predicates[0].Data)
+	require.Equal(t, argIndex("s.name.len"), predicates[0].LenArg)
+	require.Equal(t, argIndex("s.name.len"), predicates[1].Arg)
+	require.Equal(t, OpGE, predicates[1].Op)
+	require.Equal(t, uint64(0xffffffffffffffff), predicates[1].Value)
+	require.Equal(t, OpNE, predicates[2].Op)
+	require.Equal(t, uint64(42), predicates[2].Value)
+	require.Equal(t, -1, predicates[2].LenArg)
+
+	predicates, err = parsePredicates(`s.name ^= "bo" && s.name != ""`, args)
+	require.Nil(t, err)
+	require.Equal(t, OpPrefix, predicates[0].Op)
+	require.Equal(t, -1, predicates[0].LenArg)
+	require.Equal(t, OpNE, predicates[1].Op)
+	require.Empty(t, predicates[1].Data)
+
+	// == must compare the length, s.title.len is not fetched
+	title, err := newFetchArg("s.title", "(*+24(%ax)):c64")
+	require.Nil(t, err)
+	_, err = parsePredicates(`s.title == "cs"`, append(args, title))
+	require.NotNil(t, err)
+	_, err = parsePredicates(`s.title ^= "cs"`, append(args, title))
+	require.Nil(t, err)
+
+	for _, cond := range []string{
+		`s.age == 18`,           // not fetched
+		`s.name < "bob"`,        // only == and != for strings
+		`s.name == "123456789"`, // longer than c64
+		`s.name ^= ""`,          // empty prefix
+		`req.id ^= "1"`,         // ^= for integers
+		`s.name == bob`,         // not quoted
+		`req.id == -1`,          // unsigned
+		`req.id == 4294967296`,  // overflows u32
+		`req.id = 1`,            // unknown operator
+		`req.id`,                // operator not found
+	} {
+		_, err := parsePredicates(cond, args)
+		require.NotNil(t, err, cond)
+	}
+}
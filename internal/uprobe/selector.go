@@ -0,0 +1,134 @@
+package uprobe
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+)
+
+// Selector selects functions by one of the specs:
+//
+//   - glob: like main.*, see MatchWildcard
+//   - re:<regexp>: function names matching the regular expression, like re:^main\.(add|minus)$
+//   - pkg:<import path>: all functions of the package, including methods,
+//     closures and generic instantiations, like pkg:github.com/x/y
+//   - file:<file>: functions defined in the source file, like file:foo.go,
+//     file:x/y/foo.go or file:*_test.go, resolved by DWARF (or .gopclntab)
+type Selector struct {
+	Spec string
+
+	kind     string // glob, re, pkg or file
+	pattern  string
+	re       *regexp.Regexp
+	prefixes []string // symbol prefixes of pkg
+}
+
+// ParseSelector parses the selector `spec`, it's a glob if no kind prefixed
+func ParseSelector(spec string) (_ *Selector, err error) {
+	s := &Selector{Spec: spec, kind: "glob", pattern: spec}
+	if kind, pattern, ok := strings.Cut(spec, ":"); ok {
+		switch kind {
+		case "re", "pkg", "file":
+			s.kind, s.pattern = kind, pattern
+			if pattern == "" {
+				return nil, fmt.Errorf("empty selector: %s", spec)
+			}
+		}
+	}
+	switch s.kind {
+	case "re":
+		if s.re, err = regexp.Compile(s.pattern); err != nil {
+			return nil, fmt.Errorf("invalid selector %s: %w", spec, err)
+		}
+	case "pkg":
+		// symbols are prefixed by the escaped import path, see pathToPrefix,
+		// some are escaped twice, like gopkg.in/yaml%252ev3.(*encoder).mapv.func1
+		prefix := pathToPrefix(strings.TrimSuffix(s.pattern, "/"))
+		s.prefixes = []string{prefix + ".", pathToPrefix(prefix) + "."}
+	}
+	return s, nil
+}
+
+// ParseSelectors parses the selectors `specs`, see ParseSelector
+func ParseSelectors(specs []string) (selectors []*Selector, err error) {
+	for _, spec := range specs {
+		s, err := ParseSelector(spec)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, s)
+	}
+	return
+}
+
+// Match checks if function `funcname` in `e` is selected, `e` is only used
+// to resolve the source files of file selectors.
+func (s *Selector) Match(e *elf.ELF, funcname string) bool {
+	switch s.kind {
+	case "re":
+		return s.re.MatchString(funcname)
+	case "pkg":
+		// github.com/x/y.F, github.com/x/y.(*T).M, github.com/x/y.F.func1,
+		// github.com/x/y.F[go.shape.int], but not github.com/x/y/z.F
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(funcname, prefix) {
+				return true
+			}
+		}
+		return false
+	case "file":
+		if e == nil {
+			return false
+		}
+		filename, _, err := e.FuncLineInfo(funcname)
+		if err != nil {
+			return false
+		}
+		return matchFile(s.pattern, filename)
+	default:
+		return MatchWildcard(s.pattern, funcname)
+	}
+}
+
+// matchFile checks if source file `filename` (absolute path) matches `pattern`,
+// which is its base name or trailing path elements, globs are allowed.
+func matchFile(pattern, filename string) bool {
+	filename = filepath.ToSlash(filename)
+	n := strings.Count(pattern, "/") + 1
+	elems := strings.Split(filename, "/")
+	if len(elems) < n {
+		return false
+	}
+	return MatchWildcard(pattern, strings.Join(elems[len(elems)-n:], "/"))
+}
+
+// pathToPrefix converts import path to the symbol prefix used by the Go
+// linker, like cmd/internal/objabi.PathToPrefix: control characters, space,
+// `%`, `"` and non-ASCII characters are %xx escaped, and so is `.` in the
+// last path element, e.g. gopkg.in/yaml.v3 => gopkg.in/yaml%2ev3
+func pathToPrefix(path string) string {
+	slash := strings.LastIndex(path, "/")
+	sb := &strings.Builder{}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c <= ' ' || (c == '.' && i > slash) || c == '%' || c == '"' || c >= 0x7F {
+			fmt.Fprintf(sb, "%%%02x", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// matchAny returns the first selector in `selectors` selecting function `funcname`, nil if none
+func matchAny(selectors []*Selector, e *elf.ELF, funcname string) *Selector {
+	for _, s := range selectors {
+		if s.Match(e, funcname) {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package uprobe
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hitzhangjie/go-ftrace/elf"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MatchWildcard(t *testing.T) {
+	require.True(t, MatchWildcard("main.*", "main.add"))
+	require.True(t, MatchWildcard("*.String", "main.(*Student).String"))
+	require.True(t, MatchWildcard(`main.(\*Student).*`, "main.(*Student).String"))
+	require.False(t, MatchWildcard(`main.(\*Student).*`, "main.(Student).String"))
+	require.False(t, MatchWildcard("main.add", "main.add1"))
+
+	// no exponential backtracking
+	pattern := strings.Repeat("*a", 30) + "b"
+	require.False(t, MatchWildcard(pattern, strings.Repeat("a", 1000)))
+}
+
+func Test_SelectorMatch(t *testing.T) {
+	_, err := ParseSelector("re:(")
+	require.NotNil(t, err)
+
+	re, err := ParseSelector(`re:^main\.(add|minus)$`)
+	require.Nil(t, err)
+	require.True(t, re.Match(nil, "main.add"))
+	require.False(t, re.Match(nil, "main.add1"))
+
+	pkg, err := ParseSelector("pkg:github.com/x/y")
+	require.Nil(t, err)
+	for _, name := range []string{
+		"github.com/x/y.F",
+		"github.com/x/y.F.func1",
+		"github.com/x/y.(*T).M",
+		"github.com/x/y.Map[go.shape.int]",
+		"github.com/x/y.(*List[...]).Push",
+	} {
+		require.True(t, pkg.Match(nil, name), name)
+	}
+	require.False(t, pkg.Match(nil, "github.com/x/y/z.F"))
+	require.False(t, pkg.Match(nil, "github.com/x/yy.F"))
+
+	yaml, err := ParseSelector("pkg:gopkg.in/yaml.v3")
+	require.Nil(t, err)
+	require.True(t, yaml.Match(nil, "gopkg.in/yaml%2ev3.(*parser).parse"))
+	require.True(t, yaml.Match(nil, "gopkg.in/yaml%2ev3.(*encoder).mapv.func1"))
+	require.True(t, yaml.Match(nil, "gopkg.in/yaml%252ev3.(*encoder).mapv.func1"))
+	require.False(t, yaml.Match(nil, "gopkg.in/yaml%2ev3/x.F"))
+	require.False(t, yaml.Match(nil, "gopkg.in/yaml%2ev2.F"))
+}
+
+func Test_SelectorMatchFile(t *testing.T) {
+	e, err := elf.New(os.Args[0], "")
+	require.Nil(t, err)
+
+	const fn = "github.com/hitzhangjie/go-ftrace/internal/uprobe.Test_SelectorMatchFile"
+	for _, spec := range []string{"file:selector_test.go", "file:uprobe/selector_test.go", "file:*_test.go"} {
+		s, err := ParseSelector(spec)
+		require.Nil(t, err)
+		require.True(t, s.Match(e, fn), spec)
+	}
+	s, err := ParseSelector("file:parser_test.go")
+	require.Nil(t, err)
+	require.False(t, s.Match(e, fn))
+}
@@ -9,11 +9,13 @@ const (
 )
 
 type Uprobe struct {
-	Funcname  string
-	Address   uint64         // absolute address of the function entry
-	AbsOffset uint64         // absolute offset to the binary entry (ELF file beginning)
-	RelOffset uint64         // relative to the function entry
-	Location  UprobeLocation // location of the probe
-	FetchArgs []*FetchArg    // fetch arguments
-	Wanted    bool
+	Funcname   string
+	Address    uint64         // absolute address of the function entry
+	AbsOffset  uint64         // absolute offset to the binary entry (ELF file beginning)
+	RelOffset  uint64         // relative to the function entry
+	Location   UprobeLocation // location of the probe
+	FetchArgs  []*FetchArg    // fetch arguments
+	Predicates []*Predicate   // predicates on the fetched arguments to start a trace
+	Wanted     bool
+	Wildcard   string // the wildcard which selects the function
 }
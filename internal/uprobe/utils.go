@@ -1,30 +1,39 @@
 package uprobe
 
-// MatchWildcard check if regex pattern matches string str
+// MatchWildcard checks if glob pattern matches string str, `*` matches any
+// characters, and `\` escapes the next character, e.g. main.(\*Student).*
+//
+// It backtracks to the last `*` only, so it takes O(len(pattern)*len(str))
+// at worst.
 func MatchWildcard(pattern, str string) bool {
-	if len(pattern) == 0 && len(str) == 0 {
-		return true
-	}
-	if len(pattern) == 0 {
-		return false
-	}
-	if len(str) == 0 {
-		for _, p := range pattern {
-			if p != '*' {
-				return false
+	p, s := 0, 0
+	starP, starS := -1, 0 // position of the last `*`, and where it starts matching
+	for s < len(str) {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '*':
+				starP, starS = p, s
+				p++
+				continue
+			case c == '\\' && p+1 < len(pattern):
+				if pattern[p+1] == str[s] {
+					p, s = p+2, s+1
+					continue
+				}
+			case c == str[s]:
+				p, s = p+1, s+1
+				continue
 			}
 		}
-		return true
-	}
-
-	if pattern[0] == '*' {
-		for i := 0; i <= len(str); i++ {
-			if MatchWildcard(pattern[1:], str[i:]) {
-				return true
-			}
+		// mismatch, let the last `*` match one more character
+		if starP < 0 {
+			return false
 		}
-		return false
+		starS++
+		p, s = starP+1, starS
 	}
-
-	return pattern[0] == str[0] && MatchWildcard(pattern[1:], str[1:])
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
 }